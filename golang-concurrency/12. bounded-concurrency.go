@@ -0,0 +1,308 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	// Lessons 4 and 5 call wg.Add once, with the number of goroutines known up front. Real workloads rarely know it:
+	// the jobs come from a channel, a file, a paginated API... and starting a goroutine per job can mean a million
+	// goroutines hitting the same database.
+
+	// The fix is to bound the concurrency: a goroutine takes a slot before starting and gives it back when done, and
+	// when every slot is taken the spawner waits. The slots are a semaphore, and Group below packs a semaphore, a
+	// WaitGroup and the error collection together.
+	// wg.Add is still called outside the goroutine, just once per goroutine instead of once for all of them.
+
+	g, ctx := NewGroup(context.Background(), 3)
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		n := 5 + rand.Intn(10) // nobody knows how many jobs there are
+		for i := 1; i <= n; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done(): // the loop below stopped reading, don't leak (see lesson 8)
+				return
+			}
+		}
+	}()
+	var running, maxRunning atomic.Int32
+
+	for job := range jobs {
+		job := job
+		err := g.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				max := maxRunning.Load()
+				if n <= max || maxRunning.CompareAndSwap(max, n) {
+					break
+				}
+			}
+
+			select {
+			case <-time.After(10 * time.Millisecond): // the work
+			case <-ctx.Done():
+				// Another job failed, stop early. Being stopped is not a failure of this job, so no error.
+				return nil
+			}
+
+			switch job {
+			case 4:
+				var m map[string]int
+				m["boom"]++ // panics, Group turns it into an error instead of crashing the program
+			case 5:
+				return fmt.Errorf("job %d failed", job)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Not starting job %d: %v\n", job, err)
+			break // the group's context is done, no point starting more jobs
+		}
+	}
+
+	err := g.Wait()
+	fmt.Printf("At most %d jobs ran at the same time\n", maxRunning.Load())
+	fmt.Println("Errors:", err)
+
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		fmt.Printf("Recovered: %v\n", pe.Value)
+	}
+	fmt.Println("Context:", ctx.Err())
+
+	weightedSemaphore()
+}
+
+func weightedSemaphore() {
+	// A weighted semaphore hands out units instead of slots: a job asks for as many units as the resources it uses,
+	// e.g. megabytes of memory. Here 10 units, and jobs of 1 to 6 units.
+	sem := NewSemaphore(10)
+	var wg sync.WaitGroup
+
+	for i, weight := range []int64{6, 4, 3, 1, 6, 2, 12} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := sem.Acquire(ctx, weight); err != nil {
+			cancel()
+			fmt.Printf("Job %d (weight %d): %s\n", i, weight, err)
+			continue
+		}
+		cancel()
+
+		wg.Add(1)
+		go func(i int, weight int64) {
+			defer wg.Done()
+			defer sem.Release(weight)
+			fmt.Printf("Job %d (weight %d) running\n", i, weight)
+			time.Sleep(20 * time.Millisecond)
+		}(i, weight)
+	}
+	wg.Wait()
+
+	fmt.Println("TryAcquire 11 units:", sem.TryAcquire(11)) // more than the semaphore holds, never succeeds
+}
+
+// Semaphore is a weighted semaphore: it holds size units, Acquire takes some and Release gives them back.
+//
+// Waiters are served in order: a large Acquire at the head of the queue blocks the smaller ones behind it, even when
+// there would be enough units for them. Otherwise a stream of small Acquires could starve it forever.
+type Semaphore struct {
+	size int64
+
+	mu      sync.Mutex
+	cur     int64     // units taken
+	waiters list.List // of *semWaiter, oldest first
+}
+
+type semWaiter struct {
+	n     int64
+	ready chan struct{} // closed when the units are given to the waiter
+}
+
+// ErrTooLarge is returned by Acquire for more units than the semaphore holds.
+var ErrTooLarge = errors.New("semaphore: acquiring more than its size")
+
+func NewSemaphore(size int64) *Semaphore {
+	return &Semaphore{size: size}
+}
+
+// Acquire takes n units, waiting until they are available or ctx is done. On failure it takes nothing. It fails right
+// away with ErrTooLarge if n is more than the size, and when ctx is already done, even if the units are available.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	if n <= 0 {
+		return fmt.Errorf("semaphore: acquiring %d units", n)
+	}
+	if err := ctx.Err(); err != nil {
+		// Otherwise a loop starting work while Acquire succeeds keeps going after its ctx is canceled.
+		return err
+	}
+
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	if n > s.size {
+		// Can never succeed, don't queue up and block everyone behind, or wait forever on a ctx that's never done.
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %d units of %d", ErrTooLarge, n, s.size)
+	}
+
+	w := &semWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Got the units just as ctx was done, give them back.
+			s.cur -= n
+			s.notify()
+		default:
+			front := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			if front {
+				// We were blocking the waiters behind us, maybe they fit now.
+				s.notify()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes n units if they are available right away, it never waits. It returns false for n <= 0.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n > 0 && s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release gives back n units.
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 {
+		panic("semaphore: released a non-positive number of units")
+	}
+	s.cur -= n
+	if s.cur < 0 {
+		panic("semaphore: released more than held")
+	}
+	s.notify()
+}
+
+// notify hands units to the waiters at the head of the queue, for as long as they fit. s.mu must be held.
+func (s *Semaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*semWaiter)
+		if s.size-s.cur < w.n {
+			return // first come, first served, see Semaphore
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// PanicError is a panic recovered by a Group, with the stack of the goroutine that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Group runs functions in goroutines, at most limit at a time, and collects their errors.
+//
+// The first error cancels the context given to the functions, so the others can stop early, but every error is
+// kept: Wait returns all of them. A panic in a function is recovered and becomes a *PanicError.
+type Group struct {
+	sem    *Semaphore
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewGroup returns a Group running at most limit goroutines at a time, and the context its functions get.
+func NewGroup(ctx context.Context, limit int) (*Group, context.Context) {
+	if limit < 1 {
+		limit = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	g := Group{sem: NewSemaphore(int64(limit)), ctx: ctx, cancel: cancel}
+	return &g, ctx
+}
+
+// Go runs fn in a new goroutine, waiting first for one of the running ones to finish if the limit is reached.
+// It returns an error, without running fn, when the group's context is done before there's room.
+func (g *Group) Go(fn func(ctx context.Context) error) error {
+	if err := g.sem.Acquire(g.ctx, 1); err != nil {
+		return err
+	}
+
+	g.wg.Add(1) // before the goroutine starts, so Wait can't miss it
+	go func() {
+		defer g.wg.Done()
+		defer g.sem.Release(1)
+		defer func() {
+			if v := recover(); v != nil {
+				g.fail(&PanicError{Value: v, Stack: debug.Stack()})
+			}
+		}()
+
+		if err := fn(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+	return nil
+}
+
+// Wait waits for every goroutine started by Go, and returns their errors joined, nil if none failed.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(g.errs...)
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+	g.cancel()
+}
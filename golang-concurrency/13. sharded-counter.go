@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+func main() {
+	// The mutex() lesson of 5. sync-package.go guards a single count with a single Mutex. It's correct, but every
+	// increment from every goroutine goes through the same lock: with enough goroutines on enough cores, they spend
+	// more time waiting for each other than counting. That's contention.
+
+	// Three counters behind the same interface:
+	// 	- MutexCounter, the one of the lesson.
+	// 	- AtomicCounter, a single atomic add. No lock, but every core still writes to the same memory, and the cache
+	// 	  line holding it bounces from core to core.
+	// 	- ShardedCounter, one count per shard, each on its own cache line. Adds spread over the shards and rarely
+	// 	  touch the same line, Value sums them all. Adds get cheap, reads get expensive: it's for counters written
+	// 	  all the time and read once in a while, e.g. metrics.
+
+	counters := []struct {
+		name string
+		new  func() Counter
+	}{
+		{"mutex", func() Counter { return &MutexCounter{} }},
+		{"atomic", func() Counter { return &AtomicCounter{} }},
+		{"sharded", func() Counter { return NewShardedCounter(0) }},
+	}
+
+	// They all count right.
+	for _, c := range counters {
+		counter := c.new()
+		var wg sync.WaitGroup
+		wg.Add(8)
+		for i := 0; i < 8; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10000; j++ {
+					counter.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		fmt.Printf("%-8s %d\n", c.name, counter.Value())
+	}
+
+	// And they don't scale the same. BenchmarkCounter in the _test.go file runs each counter with every P adding at
+	// the same time, and reports the time per Add and how long goroutines waited on a sync.Mutex per Add - the
+	// contention. The atomic and sharded counters have no Mutex, what they pay for sharing a cache line shows up in
+	// ns/op only. -cpu runs it with GOMAXPROCS set to 1, 2, 4 and 8:
+	// go test -bench . -cpu 1,2,4,8 "13. sharded-counter.go" "13. sharded-counter_test.go"
+	// GOMAXPROCS above the number of CPUs (runtime.NumCPU) doesn't add any parallelism: the goroutines take turns on
+	// the same cores, and the mutex only gets contended when one is preempted while holding it.
+	fmt.Println("CPUs:", runtime.NumCPU())
+}
+
+// Counter is a concurrent-safe counter.
+type Counter interface {
+	Add(delta int64)
+	Value() int64
+}
+
+type MutexCounter struct {
+	mu    sync.Mutex
+	count int64
+}
+
+func (c *MutexCounter) Add(delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count += delta
+}
+
+func (c *MutexCounter) Value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+type AtomicCounter struct {
+	count atomic.Int64
+}
+
+func (c *AtomicCounter) Add(delta int64) {
+	c.count.Add(delta)
+}
+
+func (c *AtomicCounter) Value() int64 {
+	return c.count.Load()
+}
+
+// cacheLine is the size of a cache line on amd64 and most arm64, 64 bytes. Two values closer than that can share a
+// line, and a core writing one invalidates the other in every other core's cache - false sharing.
+const cacheLine = 64
+
+// shard is a count padded to a whole cache line.
+type shard struct {
+	count atomic.Int64
+	_     [cacheLine - 8]byte
+}
+
+// ShardedCounter spreads its count over shards, see main.
+type ShardedCounter struct {
+	shards []shard
+	mask   uint32
+}
+
+// NewShardedCounter returns a counter with at least n shards, rounded up to a power of 2. n <= 0 uses the number of
+// CPUs: more shards than cores that can write at the same time only make Value slower.
+func NewShardedCounter(n int) *ShardedCounter {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return &ShardedCounter{shards: make([]shard, size), mask: uint32(size - 1)}
+}
+
+// Add adds delta to a random shard. Go doesn't tell a goroutine which CPU it runs on, a random shard is the next best
+// thing: two goroutines rarely pick the same one. The top-level functions of math/rand don't take any lock, since Go
+// 1.20, so picking is cheap.
+func (c *ShardedCounter) Add(delta int64) {
+	c.shards[rand.Uint32()&c.mask].count.Add(delta)
+}
+
+// Value sums the shards. Adds made while it runs may or may not be counted.
+func (c *ShardedCounter) Value() int64 {
+	var sum int64
+	for i := range c.shards {
+		sum += c.shards[i].count.Load()
+	}
+	return sum
+}
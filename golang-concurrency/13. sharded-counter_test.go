@@ -0,0 +1,53 @@
+package main
+
+import (
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+// The lessons are run one file at a time, run the benchmark with the file it tests, for a growing GOMAXPROCS:
+//
+//	go test -bench . -cpu 1,2,4,8 "13. sharded-counter.go" "13. sharded-counter_test.go"
+
+// BenchmarkCounter measures an Add with every P adding at the same time. The wait-ns/op metric is the time per Add
+// goroutines spent waiting on a sync.Mutex.
+func BenchmarkCounter(b *testing.B) {
+	counters := []struct {
+		name string
+		new  func() Counter
+	}{
+		{"mutex", func() Counter { return &MutexCounter{} }},
+		{"atomic", func() Counter { return &AtomicCounter{} }},
+		{"sharded", func() Counter { return NewShardedCounter(0) }},
+	}
+
+	for _, c := range counters {
+		b.Run(c.name, func(b *testing.B) {
+			counter := c.new()
+			before := mutexWait()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					counter.Add(1)
+				}
+			})
+			wait := mutexWait() - before
+			b.ReportMetric(float64(wait.Nanoseconds())/float64(b.N), "wait-ns/op")
+
+			if got := counter.Value(); got != int64(b.N) {
+				b.Fatalf("counted %d, want %d", got, b.N)
+			}
+		})
+	}
+}
+
+// mutexWait returns how long goroutines have been blocked on a sync.Mutex or sync.RWMutex since the program started,
+// as measured by the runtime.
+func mutexWait() time.Duration {
+	sample := []metrics.Sample{{Name: "/sync/mutex/wait/total:seconds"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64 {
+		return 0 // not supported by this Go version
+	}
+	return time.Duration(sample[0].Value.Float64() * float64(time.Second))
+}
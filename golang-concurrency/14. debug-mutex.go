@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	// The mutex() lesson says to avoid nested locks, as they can deadlock: goroutine 1 locks A then B, goroutine 2
+	// locks B then A, and if each gets its first lock before the other gets its second one, both wait forever.
+	// The bad news is it may happen once in a million runs, the good news is it doesn't have to happen to be found:
+	// as soon as A has been locked before B once, locking them in the other order is a bug. That's what lock-order
+	// checkers (like the one of the Linux kernel, lockdep) look for.
+
+	// DebugMutex and DebugRWMutex are drop-in replacements for sync.Mutex and sync.RWMutex. Disabled, they cost an
+	// atomic load per Lock. Enabled, they record which locks every goroutine holds, and report:
+	// 	- lock order inversions, the potential deadlocks above, with the stacks of both orders
+	// 	- locks held longer than a threshold
+	// 	- goroutines waiting longer than the threshold for a lock, with the stack of whoever holds it
+	EnableLockDebug(LockDebugConfig{
+		Threshold: 50 * time.Millisecond,
+		Report: func(r LockReport) {
+			fmt.Printf("*** %s: %s\n%s\n", r.Kind, r.Message, indent(r.Stacks))
+		},
+	})
+
+	a := &DebugMutex{Name: "A"}
+	b := &DebugMutex{Name: "B"}
+
+	// Never deadlocks, the second goroutine only starts once the first is done, but the order is reported.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.Lock()
+		b.Lock()
+		b.Unlock()
+		a.Unlock()
+	}()
+	wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Lock()
+		a.Lock() // reported: A -> B was seen before
+		a.Unlock()
+		b.Unlock()
+	}()
+	wg.Wait()
+
+	// A long hold, and a goroutine waiting for it.
+	c := &DebugRWMutex{Name: "C"}
+	c.Lock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.RLock() // waits more than the threshold, reported with the stack of main holding C
+		c.RUnlock()
+	}()
+	time.Sleep(80 * time.Millisecond)
+	c.Unlock() // held 80ms, reported
+	wg.Wait()
+
+	DisableLockDebug()
+
+	// What it costs, compared to a sync.Mutex, is measured by BenchmarkDebugMutex in the _test.go file:
+	// go test -bench . "14. debug-mutex.go" "14. debug-mutex_test.go"
+}
+
+// LockDebugConfig configures the lock debugging of EnableLockDebug.
+type LockDebugConfig struct {
+	Threshold time.Duration    // report holds and waits longer than this, never if 0
+	Report    func(LockReport) // where the reports go, stderr if nil
+}
+
+// LockReport is a problem found by the lock debugging.
+type LockReport struct {
+	Kind    string // "lock order", "long hold" or "long wait"
+	Message string
+	Stacks  []string
+}
+
+// lockDebugger is the state of the lock debugging, shared by every DebugMutex and DebugRWMutex.
+type lockDebugger struct {
+	enabled atomic.Bool
+
+	mu       sync.Mutex
+	cfg      LockDebugConfig
+	held     map[int64][]*holding   // by goroutine id, in the order they were locked
+	order    map[any]map[any]string // order[a][b] is the stack of the first time b was locked while holding a
+	reported map[[2]any]bool        // inversions already reported, each is reported once
+}
+
+var lockDebug lockDebugger
+
+// holding is a lock held, or being waited for, by a goroutine.
+type holding struct {
+	lock  any // the *DebugMutex or *DebugRWMutex
+	name  string
+	gid   int64
+	stack string
+	since time.Time
+	wait  *time.Timer // reports a long wait, stopped once the lock is acquired
+}
+
+// EnableLockDebug turns the lock debugging on, for every DebugMutex and DebugRWMutex. Locks taken before it was
+// enabled are not known to it.
+func EnableLockDebug(cfg LockDebugConfig) {
+	if cfg.Report == nil {
+		cfg.Report = func(r LockReport) {
+			println("lock debug:", r.Kind+":", r.Message+"\n"+indent(r.Stacks))
+		}
+	}
+
+	lockDebug.mu.Lock()
+	defer lockDebug.mu.Unlock()
+	lockDebug.cfg = cfg
+	lockDebug.held = make(map[int64][]*holding)
+	lockDebug.order = make(map[any]map[any]string)
+	lockDebug.reported = make(map[[2]any]bool)
+	lockDebug.enabled.Store(true)
+}
+
+func DisableLockDebug() {
+	lockDebug.enabled.Store(false)
+}
+
+// DebugMutex is a sync.Mutex checked by the lock debugging when it's enabled. Name shows up in the reports.
+type DebugMutex struct {
+	Name string
+	mu   sync.Mutex
+}
+
+func (m *DebugMutex) Lock() {
+	if !lockDebug.enabled.Load() {
+		m.mu.Lock()
+		return
+	}
+	h := beforeLock(m, m.Name)
+	m.mu.Lock()
+	acquired(h)
+}
+
+func (m *DebugMutex) Unlock() {
+	m.mu.Unlock()
+	if lockDebug.enabled.Load() {
+		released(m)
+	}
+}
+
+// DebugRWMutex is a sync.RWMutex checked by the lock debugging when it's enabled. Read locks take part in the lock
+// order like write locks: a reader waiting for a writer, waiting for the reader, is a deadlock as well.
+type DebugRWMutex struct {
+	Name string
+	mu   sync.RWMutex
+}
+
+func (m *DebugRWMutex) Lock() {
+	if !lockDebug.enabled.Load() {
+		m.mu.Lock()
+		return
+	}
+	h := beforeLock(m, m.Name)
+	m.mu.Lock()
+	acquired(h)
+}
+
+func (m *DebugRWMutex) Unlock() {
+	m.mu.Unlock()
+	if lockDebug.enabled.Load() {
+		released(m)
+	}
+}
+
+func (m *DebugRWMutex) RLock() {
+	if !lockDebug.enabled.Load() {
+		m.mu.RLock()
+		return
+	}
+	h := beforeLock(m, m.Name)
+	m.mu.RLock()
+	acquired(h)
+}
+
+func (m *DebugRWMutex) RUnlock() {
+	m.mu.RUnlock()
+	if lockDebug.enabled.Load() {
+		released(m)
+	}
+}
+
+// beforeLock records that the current goroutine is about to wait for lock, and checks the order against the locks it
+// already holds. It runs before waiting, so the report is out even when the goroutine then deadlocks.
+func beforeLock(lock any, name string) *holding {
+	if name == "" {
+		name = fmt.Sprintf("%p", lock)
+	}
+	h := &holding{lock: lock, name: name, gid: goid(), stack: stack()}
+
+	d := &lockDebug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, prev := range d.held[h.gid] {
+		if prev.lock == lock {
+			d.report(LockReport{
+				Kind:    "lock order",
+				Message: fmt.Sprintf("goroutine %d locks %s again, it already holds it", h.gid, name),
+				Stacks:  []string{prev.stack, h.stack},
+			})
+			continue
+		}
+
+		if d.order[prev.lock] == nil {
+			d.order[prev.lock] = make(map[any]string)
+		}
+		if _, ok := d.order[prev.lock][lock]; !ok {
+			d.order[prev.lock][lock] = h.stack
+		}
+
+		// Locking lock while holding prev is an inversion if lock was ever held while locking prev, directly or
+		// through other locks.
+		if path := d.path(lock, prev.lock); path != nil && !d.reported[[2]any{prev.lock, lock}] {
+			d.reported[[2]any{prev.lock, lock}] = true
+			d.reported[[2]any{lock, prev.lock}] = true
+			d.report(LockReport{
+				Kind: "lock order",
+				Message: fmt.Sprintf("goroutine %d locks %s while holding %s, but %s was locked while holding %s before: "+
+					"potential deadlock", h.gid, name, prev.name, prev.name, name),
+				Stacks: append([]string{h.stack}, path...),
+			})
+		}
+	}
+
+	if t := d.cfg.Threshold; t > 0 {
+		h.wait = time.AfterFunc(t, func() { longWait(h) })
+	}
+	return h
+}
+
+// acquired records that the goroutine of h got its lock.
+func acquired(h *holding) {
+	d := &lockDebug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if h.wait != nil {
+		h.wait.Stop()
+	}
+	h.since = time.Now()
+	d.held[h.gid] = append(d.held[h.gid], h)
+}
+
+// released forgets a holding of lock, the current goroutine's if it has one. A Mutex can be unlocked by another
+// goroutine than the one that locked it, then any holding of lock is forgotten.
+func released(lock any) {
+	d := &lockDebug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h := d.remove(goid(), lock)
+	for gid := range d.held {
+		if h != nil {
+			break
+		}
+		h = d.remove(gid, lock)
+	}
+	if h == nil {
+		return // locked before the debugging was enabled
+	}
+
+	if held := time.Since(h.since); d.cfg.Threshold > 0 && held > d.cfg.Threshold {
+		d.report(LockReport{
+			Kind:    "long hold",
+			Message: fmt.Sprintf("%s held for %s by goroutine %d", h.name, held.Round(time.Millisecond), h.gid),
+			Stacks:  []string{h.stack},
+		})
+	}
+}
+
+// longWait reports a goroutine waiting for a lock for longer than the threshold, with the stacks of the holders.
+func longWait(h *holding) {
+	d := &lockDebug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stacks := []string{h.stack}
+	for _, held := range d.held {
+		for _, other := range held {
+			if other.lock == h.lock {
+				stacks = append(stacks, other.stack)
+			}
+		}
+	}
+	d.report(LockReport{
+		Kind:    "long wait",
+		Message: fmt.Sprintf("goroutine %d waits for %s for more than %s, held by %d goroutines", h.gid, h.name, d.cfg.Threshold, len(stacks)-1),
+		Stacks:  stacks,
+	})
+}
+
+// path returns the stacks of a chain of locks taken in order from from to to, nil if there's none. d.mu must be held.
+func (d *lockDebugger) path(from, to any) []string {
+	seen := map[any]bool{from: true}
+	var walk func(lock any) []string
+	walk = func(lock any) []string {
+		for next, stack := range d.order[lock] {
+			if next == to {
+				return []string{stack}
+			}
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			if rest := walk(next); rest != nil {
+				return append([]string{stack}, rest...)
+			}
+		}
+		return nil
+	}
+	return walk(from)
+}
+
+// remove takes the holding of lock out of the locks held by gid. d.mu must be held.
+func (d *lockDebugger) remove(gid int64, lock any) *holding {
+	held := d.held[gid]
+	for i := len(held) - 1; i >= 0; i-- { // most likely the last one locked
+		if held[i].lock == lock {
+			h := held[i]
+			d.held[gid] = append(held[:i:i], held[i+1:]...)
+			if len(d.held[gid]) == 0 {
+				delete(d.held, gid)
+			}
+			return h
+		}
+	}
+	return nil
+}
+
+// report calls the Report function of the config. It runs with d.mu held, so reports never interleave, and Report
+// must not lock a DebugMutex.
+func (d *lockDebugger) report(r LockReport) {
+	d.cfg.Report(r)
+}
+
+// goid returns the id of the current goroutine. Go hides it on purpose, so nobody builds goroutine-local storage on
+// it, but the first line of a stack trace has it: "goroutine 42 [running]:". Slow, fine for debugging only.
+func goid() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// stack returns the stack of the current goroutine, without the frames of the lock debugging itself.
+func stack() string {
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	// lines[0] is the goroutine header, then each frame is a function line and a file:line line. Skip stack,
+	// beforeLock and the Lock method.
+	const skip = 3
+	if len(lines) > 1+2*skip {
+		lines = append(lines[:1], lines[1+2*skip:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indent(stacks []string) string {
+	var sb strings.Builder
+	for _, s := range stacks {
+		for _, line := range strings.Split(s, "\n") {
+			sb.WriteString("    ")
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
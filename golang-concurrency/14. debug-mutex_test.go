@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The lessons are run one file at a time, run the tests and the benchmark with the file they test:
+//
+//	go test -bench . "14. debug-mutex.go" "14. debug-mutex_test.go"
+
+// recordLocks enables the lock debugging for the test, and returns the reports made so far.
+func recordLocks(t *testing.T) func() []LockReport {
+	var mu sync.Mutex
+	var reports []LockReport
+	EnableLockDebug(LockDebugConfig{
+		Report: func(r LockReport) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, r)
+		},
+	})
+	t.Cleanup(DisableLockDebug)
+
+	return func() []LockReport {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]LockReport(nil), reports...)
+	}
+}
+
+// lockBoth locks first then second, and unlocks them, in a new goroutine.
+func lockBoth(first, second *DebugMutex) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first.Lock()
+		second.Lock()
+		second.Unlock()
+		first.Unlock()
+	}()
+	wg.Wait()
+}
+
+func TestLockOrderInversion(t *testing.T) {
+	reports := recordLocks(t)
+	a := &DebugMutex{Name: "A"}
+	b := &DebugMutex{Name: "B"}
+
+	lockBoth(a, b)
+	lockBoth(a, b) // the same order again is fine
+	if r := reports(); len(r) != 0 {
+		t.Fatalf("reports for a consistent order: %+v", r)
+	}
+
+	lockBoth(b, a)
+	r := reports()
+	if len(r) != 1 {
+		t.Fatalf("%d reports, want 1: %+v", len(r), r)
+	}
+	if r[0].Kind != "lock order" || !strings.Contains(r[0].Message, "locks A while holding B") {
+		t.Errorf("report %s: %s, want a lock order inversion of A and B", r[0].Kind, r[0].Message)
+	}
+	if len(r[0].Stacks) < 2 {
+		t.Errorf("%d stacks, want both orders", len(r[0].Stacks))
+	}
+
+	lockBoth(b, a) // each inversion is reported once
+	if r := reports(); len(r) != 1 {
+		t.Errorf("%d reports after the inversion happened again, want still 1", len(r))
+	}
+}
+
+// BenchmarkDebugMutex compares an uncontended Lock and Unlock of a sync.Mutex and of a DebugMutex, with the lock
+// debugging disabled and enabled.
+func BenchmarkDebugMutex(b *testing.B) {
+	bench := func(b *testing.B, lock, unlock func()) {
+		for i := 0; i < b.N; i++ {
+			lock()
+			unlock()
+		}
+	}
+
+	b.Run("sync.Mutex", func(b *testing.B) {
+		var m sync.Mutex
+		bench(b, m.Lock, m.Unlock)
+	})
+	b.Run("disabled", func(b *testing.B) {
+		var m DebugMutex
+		bench(b, m.Lock, m.Unlock)
+	})
+	b.Run("enabled", func(b *testing.B) {
+		EnableLockDebug(LockDebugConfig{})
+		defer DisableLockDebug()
+		var m DebugMutex
+		bench(b, m.Lock, m.Unlock)
+	})
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func main() {
+	// A WaitGroup is a one way rendezvous: one goroutine waits for the others. Sometimes the others need to wait for
+	// each other, e.g. workers of a simulation that must all finish step 1 before any starts step 2. These three are
+	// the classic primitives for that, built on sync.Cond like condSignal in 5. sync-package.go.
+	//	- A countdown latch opens once counted down N times, and stays open. A WaitGroup that can be waited on with a
+	//	  context, by any number of goroutines.
+	//	- A cyclic barrier makes N goroutines wait until all N arrived, then lets them all go, and starts over for the
+	//	  next phase.
+	//	- A phaser is a barrier where parties can join and leave between phases.
+	latch()
+	barrier()
+	phaser()
+}
+
+func latch() {
+	// The main goroutine waits for 3 services to be ready, but not for more than 100ms.
+	ready := NewLatch(3)
+	for _, name := range []string{"database", "cache", "queue"} {
+		go func(name string) {
+			time.Sleep(10 * time.Millisecond)
+			fmt.Println(name, "ready")
+			ready.CountDown()
+		}(name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := ready.Await(ctx); err != nil {
+		fmt.Println("Not ready:", err)
+		return
+	}
+	fmt.Println("All services ready")
+	fmt.Println("**************************************************************************************************")
+}
+
+func barrier() {
+	// 3 workers, 3 steps, no worker starts a step before all finished the previous one.
+	const workers = 3
+	b := NewBarrier(workers, func() {
+		fmt.Println("--- step done") // run once per phase, by the last goroutine to arrive, before the others leave
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 1; w <= workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for step := 1; step <= 3; step++ {
+				time.Sleep(time.Duration(w) * time.Millisecond) // workers of different speeds
+				fmt.Printf("Worker %d finished step %d\n", w, step)
+				if err := b.Await(context.Background()); err != nil {
+					fmt.Println("Worker", w, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// A worker that gives up breaks the barrier for everyone waiting, instead of leaving them waiting forever.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		fmt.Println("Impatient worker:", b.Await(ctx))
+	}()
+	go func() {
+		defer wg.Done()
+		fmt.Println("Patient worker:", b.Await(context.Background()))
+	}()
+	wg.Wait()
+	b.Reset() // usable again
+	fmt.Println("**************************************************************************************************")
+}
+
+func phaser() {
+	// Workers join while the work runs, each does a few phases and leaves. Every phase waits for the workers
+	// registered at the time.
+	p := NewPhaser(1) // main is a party too, so phase 0 doesn't advance before the workers are registered
+
+	var wg sync.WaitGroup
+	work := func(name string, phases int) {
+		defer wg.Done()
+		for i := 0; i < phases; i++ {
+			phase, err := p.ArriveAndAwait(context.Background())
+			if err != nil {
+				fmt.Println(name, err)
+				return
+			}
+			fmt.Printf("%s: phase %d done\n", name, phase)
+		}
+		p.ArriveAndDeregister()
+	}
+
+	for i, phases := range []int{1, 2, 3} {
+		p.Register()
+		wg.Add(1)
+		go work(fmt.Sprintf("Worker %d", i+1), phases)
+	}
+
+	// main doesn't take part in the phases, it only had to hold phase 0 back while registering.
+	p.ArriveAndDeregister()
+	wg.Wait()
+	fmt.Printf("Phase %d, terminated: %v\n", p.Phase(), p.Terminated())
+}
+
+var (
+	ErrBarrierBroken    = errors.New("barrier broken")
+	ErrPhaserTerminated = errors.New("phaser terminated")
+)
+
+// waitCond waits on c until done returns true or ctx is done. c.L must be held. It's the wait of BlockingQueue in
+// 5. sync-package.go, see wakeOnDone there for how it works.
+func waitCond(ctx context.Context, c *sync.Cond, done func() bool) error {
+	stop := context.AfterFunc(ctx, func() {
+		c.L.Lock()
+		defer c.L.Unlock()
+		c.Broadcast()
+	})
+	defer stop()
+
+	for !done() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.Wait()
+	}
+	return nil
+}
+
+// Latch is a countdown latch: Await waits until CountDown has been called count times.
+type Latch struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	count int
+}
+
+// NewLatch returns a latch opening after count CountDowns. It panics if count isn't positive, such a latch could never
+// open.
+func NewLatch(count int) *Latch {
+	if count <= 0 {
+		panic("latch: count must be positive")
+	}
+	l := Latch{count: count}
+	l.cond = sync.NewCond(&l.mu)
+	return &l
+}
+
+// CountDown decrements the count, opening the latch when it gets to 0. Extra calls do nothing.
+func (l *Latch) CountDown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		l.cond.Broadcast()
+	}
+}
+
+func (l *Latch) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Await waits for the latch to open, or ctx to be done.
+func (l *Latch) Await(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return waitCond(ctx, l.cond, func() bool { return l.count == 0 })
+}
+
+// Barrier is a cyclic barrier for a fixed number of parties.
+//
+// Every phase is a generation: when the last party arrives, a new generation starts and that's what the waiters wait
+// for. Waiting on a counter going back to 0 instead would miss it, a fast party can arrive for the next phase before
+// a slow one wakes up. Breaking is per generation too, so a Reset right after a break can't hide it from the
+// waiters of the broken generation.
+type Barrier struct {
+	parties int
+	action  func()
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	arrived int
+	gen     *generation
+}
+
+type generation struct {
+	broken bool
+}
+
+// NewBarrier returns a barrier for parties goroutines. action, if not nil, runs when the last one arrives, before
+// any of them leaves. If it panics, the barrier breaks and the panic goes on in the goroutine that ran it.
+// NewBarrier panics if parties isn't positive, every Await would wait forever.
+func NewBarrier(parties int, action func()) *Barrier {
+	if parties <= 0 {
+		panic("barrier: parties must be positive")
+	}
+	b := Barrier{parties: parties, action: action, gen: &generation{}}
+	b.cond = sync.NewCond(&b.mu)
+	return &b
+}
+
+// Await waits for every party to arrive. If ctx is done first, the barrier breaks: Await returns ctx.Err() here and
+// ErrBarrierBroken to every other party, waiting or arriving later, until Reset.
+func (b *Barrier) Await(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	gen := b.gen
+	if gen.broken {
+		return ErrBarrierBroken
+	}
+
+	b.arrived++
+	if b.arrived == b.parties {
+		if b.action != nil {
+			broken := true
+			defer func() {
+				if broken {
+					b.breakGen() // the action panicked, the phase never ends: don't leave the others waiting for it
+				}
+			}()
+			b.action()
+			broken = false
+		}
+		b.next()
+		return nil
+	}
+
+	err := waitCond(ctx, b.cond, func() bool { return b.gen != gen || gen.broken })
+	switch {
+	case gen.broken:
+		return ErrBarrierBroken
+	case b.gen != gen:
+		return nil // made it, even if ctx got done meanwhile
+	default:
+		b.breakGen()
+		return err
+	}
+}
+
+// Reset repairs a broken barrier, starting a new phase with nobody arrived. Parties waiting get ErrBarrierBroken.
+func (b *Barrier) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.arrived > 0 {
+		b.breakGen()
+	}
+	b.next()
+}
+
+// next starts a new generation. b.mu must be held.
+func (b *Barrier) next() {
+	b.arrived = 0
+	b.gen = &generation{}
+	b.cond.Broadcast()
+}
+
+// breakGen breaks the current generation. b.mu must be held.
+func (b *Barrier) breakGen() {
+	b.gen.broken = true
+	b.cond.Broadcast()
+}
+
+// Phaser is a reusable barrier whose number of parties can change: parties Register, and ArriveAndDeregister when
+// they're done. A phase advances when every registered party arrived. Once the last party deregisters, the phaser is
+// terminated.
+type Phaser struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	parties    int
+	arrived    int
+	phase      int
+	terminated bool
+}
+
+// NewPhaser returns a phaser with parties registered, in phase 0. It panics if parties is negative.
+func NewPhaser(parties int) *Phaser {
+	if parties < 0 {
+		panic("phaser: negative parties")
+	}
+	p := Phaser{parties: parties}
+	p.cond = sync.NewCond(&p.mu)
+	return &p
+}
+
+// Register adds a party, it takes part from the current phase on. It returns the current phase.
+func (p *Phaser) Register() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.parties++
+	p.terminated = false
+	return p.phase
+}
+
+// Arrive records the arrival of a party without waiting for the others. It returns the phase it arrived in.
+func (p *Phaser) Arrive() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.arrive(false)
+}
+
+// ArriveAndDeregister records the arrival of a party and removes it, without waiting for the others.
+func (p *Phaser) ArriveAndDeregister() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.arrive(true)
+}
+
+// ArriveAndAwait records the arrival of a party and waits for the phase to advance. It returns the phase it arrived
+// in. If ctx is done first it returns ctx.Err(), but the arrival counts: the party must not arrive again in the
+// same phase.
+func (p *Phaser) ArriveAndAwait(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.terminated {
+		return p.phase, ErrPhaserTerminated
+	}
+	phase := p.arrive(false)
+	return phase, waitCond(ctx, p.cond, func() bool { return p.phase != phase || p.terminated })
+}
+
+// AwaitPhase waits for the phaser to be past phase, without being a party.
+func (p *Phaser) AwaitPhase(ctx context.Context, phase int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := waitCond(ctx, p.cond, func() bool { return p.phase > phase || p.terminated })
+	if err == nil && p.terminated && p.phase <= phase {
+		return ErrPhaserTerminated
+	}
+	return err
+}
+
+func (p *Phaser) Phase() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.phase
+}
+
+func (p *Phaser) Terminated() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.terminated
+}
+
+// arrive counts an arrival, advancing the phase if it's the last one. p.mu must be held.
+func (p *Phaser) arrive(deregister bool) int {
+	phase := p.phase
+	if deregister {
+		p.parties--
+	} else {
+		p.arrived++
+	}
+
+	switch {
+	case p.parties <= 0:
+		p.parties, p.arrived = 0, 0
+		p.terminated = true
+		p.cond.Broadcast()
+	case p.arrived >= p.parties:
+		p.arrived = 0
+		p.phase++
+		p.cond.Broadcast()
+	}
+	return phase
+}
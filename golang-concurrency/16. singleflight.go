@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	// githubInfo of practical-go/day-1 calls the GitHub API for every login it's given. Have 10 goroutines serving
+	// requests for the same profile at the same time, and it's 10 identical calls, all as slow as each other, counting
+	// against the same rate limit.
+	// Coalescing the requests fixes it: the first goroutine asking for a key makes the call, the ones asking for the
+	// same key while it's in flight wait for it and share its result. Group below also caches the results for a short
+	// while, so the requests that come right after don't call again either.
+
+	var calls atomic.Int32
+	githubInfo := func(login string) func(ctx context.Context) (Info, error) {
+		return func(ctx context.Context) (Info, error) {
+			calls.Add(1)
+			select {
+			case <-time.After(50 * time.Millisecond): // the HTTP call
+				return Info{Name: strings.ToUpper(login), Repos: len(login)}, nil
+			case <-ctx.Done():
+				return Info{}, ctx.Err()
+			}
+		}
+	}
+
+	g := Group[string, Info]{TTL: 100 * time.Millisecond}
+	var wg sync.WaitGroup
+	var shared atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, s, err := g.Do(context.Background(), "tebeka", githubInfo("tebeka"))
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+			if s {
+				shared.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("10 requests, %d call, %d shared results\n", calls.Load(), shared.Load())
+
+	info, s, _ := g.Do(context.Background(), "tebeka", githubInfo("tebeka"))
+	fmt.Printf("Right after: %+v, shared: %v, calls: %d\n", info, s, calls.Load()) // from the cache
+
+	time.Sleep(150 * time.Millisecond) // the cached result expires
+	g.Do(context.Background(), "tebeka", githubInfo("tebeka"))
+	fmt.Println("After the TTL, calls:", calls.Load())
+	fmt.Println("**************************************************************************************************")
+
+	cancellation(&g, githubInfo)
+}
+
+func cancellation(g *Group[string, Info], githubInfo func(string) func(context.Context) (Info, error)) {
+	// A caller giving up doesn't cancel the call for the others: the impatient caller gets its ctx error right away,
+	// the patient one still gets the result.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := g.Do(ctx, "yasssuz", githubInfo("yasssuz"))
+		fmt.Println("Impatient caller:", err)
+	}()
+	go func() {
+		defer wg.Done()
+		info, _, err := g.Do(context.Background(), "yasssuz", githubInfo("yasssuz"))
+		fmt.Printf("Patient caller: %+v %v\n", info, err)
+	}()
+	wg.Wait()
+
+	// When every caller gave up, nobody wants the result anymore: the call's context is canceled, so it can stop.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := g.Do(ctx, "golang", githubInfo("golang"))
+	fmt.Println("Only caller:", err)
+}
+
+type Info struct {
+	Name  string
+	Repos int
+}
+
+// Group coalesces calls by key: while a call for a key is in flight, Do for the same key waits for it instead of
+// making another one. The zero Group is ready to use, and doesn't cache.
+type Group[K comparable, V any] struct {
+	// TTL is how long a successful result is kept after the call returns: Do for the key returns it without calling
+	// again until then. Errors are never cached, the next Do calls again. 0 means no caching.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+// call is an in flight or cached call.
+type call[V any] struct {
+	done    chan struct{} // closed when fn returned, val and err are set then
+	val     V
+	err     error
+	waiters int                // callers waiting for it, guarded by Group.mu
+	cancel  context.CancelFunc // cancels the context given to fn
+}
+
+// Do returns the result of fn for key, calling it only if no call for key is in flight or cached. shared reports
+// whether the result went to more than one caller, or came from the cache.
+//
+// fn doesn't run with the context of the caller that started it, since that caller may give up while others still
+// wait: it gets a context canceled only when every caller waiting for it gave up. The values of ctx are kept.
+// When ctx is done before the result is there, Do returns ctx.Err() to that caller alone.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	c, ok := g.calls[key]
+	if ok {
+		select {
+		case <-c.done:
+			// Cached, the entry is removed when it expires (see run).
+			g.mu.Unlock()
+			return c.val, true, nil
+		default:
+		}
+		c.waiters++
+		g.mu.Unlock()
+		return g.wait(ctx, key, c, true)
+	}
+
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c = &call[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go g.run(callCtx, key, c, fn)
+	return g.wait(ctx, key, c, false)
+}
+
+// Forget drops the cached result for key, if any, so the next Do calls again. A call in flight isn't affected, but
+// its result won't be cached.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
+
+// wait waits for c, or for ctx to be done. In that case the caller leaves, and if it was the last one the call is
+// canceled.
+func (g *Group[K, V]) wait(ctx context.Context, key K, c *call[V], shared bool) (V, bool, error) {
+	select {
+	case <-c.done:
+		g.mu.Lock()
+		shared = shared || c.waiters > 1
+		g.mu.Unlock()
+		return c.val, shared, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		select {
+		case <-c.done:
+			// The call completed while ctx was done too. Leave c alone, the entry in calls may be its cached
+			// result, or already a newer call for the same key.
+			var zero V
+			return zero, false, ctx.Err()
+		default:
+		}
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			// A caller coming now must not join a canceled call.
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		var zero V
+		return zero, false, ctx.Err()
+	}
+}
+
+// run calls fn in its own goroutine, so a caller giving up can return without waiting for it.
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(ctx context.Context) (V, error)) {
+	defer func() {
+		if v := recover(); v != nil {
+			// No caller would be there to recover it, it would crash the program.
+			c.err = fmt.Errorf("singleflight: panic: %v", v)
+		}
+		c.cancel()
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		close(c.done)
+		if g.calls[key] != c {
+			return // forgotten, or canceled by every caller
+		}
+		if c.err != nil || g.TTL <= 0 {
+			delete(g.calls, key)
+			return
+		}
+		time.AfterFunc(g.TTL, func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		})
+	}()
+
+	c.val, c.err = fn(ctx)
+}
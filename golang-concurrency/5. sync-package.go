@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -46,10 +50,15 @@ func main() {
 	fmt.Println("**************************************************************************************************")
 
 	//mutex()
+	//rwMutex()
 	//condSignal()
+	//blockingQueue()
 	//condBroadcast()
+	//eventBus()
 	//once()
+	//onceErr()
 	poolEx1()
+	//poolEx2()
 }
 
 func mutex() {
@@ -106,7 +115,145 @@ func mutex() {
 }
 
 func rwMutex() {
-	// TODO write example
+	// RWMutex is a Mutex with two kinds of lock: many goroutines can hold the read lock (RLock) at the same time, but
+	// the write lock (Lock) is exclusive, it waits for every reader to leave and keeps new ones out while it's held.
+	// It's made for data read much more often than written, e.g. a cache, which is what Cache below is.
+	// It's not free though: RLock still updates a counter shared by every reader, and that costs more than a Mutex when
+	// the critical section is as short as a map lookup. Measure before picking one, see BenchmarkCache in
+	// 5. sync-package_test.go.
+	c := NewCache[string, int](50*time.Millisecond, 10*time.Millisecond)
+	defer c.Close() // stop the janitor, otherwise its goroutine leaks
+
+	c.Set("answer", 42)
+	c.SetTTL("forever", 1, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			defer wg.Done()
+			v, ok := c.Get("answer") // readers don't block each other
+			fmt.Printf("Reader %d: %d %v\n", i, v, ok)
+		}(i)
+	}
+	wg.Wait()
+
+	time.Sleep(100 * time.Millisecond) // long enough for "answer" to expire and the janitor to remove it
+	_, ok := c.Get("answer")
+	fmt.Printf("After the TTL: answer found %v, %d entries left\n", ok, c.Len())
+}
+
+// Cache is a concurrent-safe map whose entries expire after a TTL. It's read-mostly, so it's guarded by a RWMutex:
+// any number of Gets run at the same time, only Set, Delete and the janitor take the write lock.
+//
+// Expired entries are never returned, Get checks the expiry itself. Removing them, so the memory is freed, is the job
+// of the janitor, a goroutine waking up every cleanup interval. Close stops it.
+type Cache[K comparable, V any] struct {
+	mu      sync.RWMutex
+	entries map[K]cacheEntry[V]
+	ttl     time.Duration
+
+	stop chan struct{}
+	done chan struct{} // closed by the janitor when it returns
+	once sync.Once     // Close can be called more than once
+}
+
+type cacheEntry[V any] struct {
+	value   V
+	expires time.Time // zero never expires
+}
+
+// NewCache returns a Cache whose entries live for ttl, and a janitor removing expired entries every cleanup.
+// A ttl of 0 means entries never expire. A cleanup of 0 or less starts no janitor: expired entries are still never
+// returned, but they stay in memory until overwritten or deleted.
+func NewCache[K comparable, V any](ttl, cleanup time.Duration) *Cache[K, V] {
+	c := &Cache[K, V]{
+		entries: make(map[K]cacheEntry[V]),
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cleanup <= 0 {
+		close(c.done) // nothing for Close to wait for
+		return c
+	}
+	go c.janitor(cleanup)
+	return c
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value for the ttl of the cache.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetTTL(key, value, c.ttl)
+}
+
+// SetTTL stores value for ttl, 0 never expires.
+func (c *Cache[K, V]) SetTTL(key K, value V, ttl time.Duration) {
+	e := cacheEntry[V]{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl) // outside of the lock, keep the critical section small
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = e
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Len returns the number of entries, expired ones the janitor didn't remove yet included.
+func (c *Cache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Close stops the janitor and waits for it to return.
+func (c *Cache[K, V]) Close() {
+	c.once.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+func (c *Cache[K, V]) janitor(every time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.removeExpired(now)
+		}
+	}
+}
+
+func (c *Cache[K, V]) removeExpired(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
 }
 
 func condSignal() {
@@ -164,6 +311,197 @@ func condSignal() {
 	fmt.Println("**************************************************************************************************")
 }
 
+func blockingQueue() {
+	// condSignal again, with the queue, the Cond and the capacity of 2 packed into a BlockingQueue.
+	q := NewBlockingQueue[int](2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			v, err := q.Take(context.Background()) // blocks until there's something to take, or the queue is closed
+			if err != nil {
+				fmt.Println("Consumer:", err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+			fmt.Println("Removed from queue", v)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		q.Put(context.Background(), i) // blocks while the queue is full
+		fmt.Println("Adding to queue", i)
+	}
+
+	// TryPut gives up right away when the queue is full, Put with a timeout waits at most 10ms for room.
+	fmt.Println("TryPut 10:", q.TryPut(10))
+	fmt.Println("TryPut 11:", q.TryPut(11))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	fmt.Println("Put 12:", q.Put(ctx, 12))
+
+	q.Close() // the consumer takes what's left, then gets ErrQueueClosed
+	wg.Wait()
+
+	// The TestBlockingQueue tests put many producers and consumers on it at once, run them with the race detector:
+	// go test -race -run BlockingQueue "5. sync-package.go" "5. sync-package_test.go"
+	fmt.Println("**************************************************************************************************")
+}
+
+var ErrQueueClosed = errors.New("queue closed")
+
+// BlockingQueue is a FIFO queue holding at most a fixed number of values. Put waits while it's full and Take waits
+// while it's empty, both on a sync.Cond like condSignal: notFull is signaled when a value is taken, notEmpty when one
+// is put. They wait with a context, see wakeOnDone.
+type BlockingQueue[T any] struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	items  []T // ring buffer, the capacity of the queue
+	head   int // index of the oldest value
+	n      int // number of values
+	closed bool
+}
+
+func NewBlockingQueue[T any](capacity int) *BlockingQueue[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := BlockingQueue[T]{items: make([]T, capacity)}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return &q
+}
+
+// Put adds v at the end of the queue, waiting for room until ctx is done. It fails once the queue is closed.
+func (q *BlockingQueue[T]) Put(ctx context.Context, v T) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stop := q.wakeOnDone(ctx, q.notFull)
+	defer stop()
+
+	for q.n == len(q.items) && !q.closed && ctx.Err() == nil {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.push(v)
+	return nil
+}
+
+// Take removes the value at the front of the queue, waiting for one until ctx is done. Once the queue is closed, Take
+// still returns the values left in it, then fails with ErrQueueClosed.
+func (q *BlockingQueue[T]) Take(ctx context.Context) (T, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stop := q.wakeOnDone(ctx, q.notEmpty)
+	defer stop()
+
+	for q.n == 0 && !q.closed && ctx.Err() == nil {
+		q.notEmpty.Wait()
+	}
+	if q.n > 0 {
+		return q.pop(), nil
+	}
+
+	var zero T
+	if q.closed {
+		return zero, ErrQueueClosed
+	}
+	return zero, ctx.Err()
+}
+
+// TryPut adds v if there's room right away, it never waits.
+func (q *BlockingQueue[T]) TryPut(v T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || q.n == len(q.items) {
+		return false
+	}
+	q.push(v)
+	return true
+}
+
+// TryTake removes the value at the front if there's one, it never waits.
+func (q *BlockingQueue[T]) TryTake() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.n == 0 {
+		var zero T
+		return zero, false
+	}
+	return q.pop(), true
+}
+
+// Drain removes every value in the queue and returns them, oldest first.
+func (q *BlockingQueue[T]) Drain() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	values := make([]T, 0, q.n)
+	for q.n > 0 {
+		values = append(values, q.pop())
+	}
+	return values
+}
+
+func (q *BlockingQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// Close makes every Put fail, and wakes up every goroutine waiting in Put or Take: Broadcast, not Signal, as all of
+// them have to notice.
+func (q *BlockingQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// push and pop must be called with q.mu held.
+func (q *BlockingQueue[T]) push(v T) {
+	q.items[(q.head+q.n)%len(q.items)] = v
+	q.n++
+	q.notEmpty.Signal()
+}
+
+func (q *BlockingQueue[T]) pop() T {
+	var zero T
+	v := q.items[q.head]
+	q.items[q.head] = zero // don't keep v reachable from the ring
+	q.head = (q.head + 1) % len(q.items)
+	q.n--
+	q.notFull.Signal()
+	return v
+}
+
+// wakeOnDone broadcasts c when ctx is done. A Cond can't wait on a context, so a context.AfterFunc does the waking
+// up: the waiters wake up, see ctx.Err() and give up. It takes the lock to broadcast, so it can't happen between a
+// waiter checking ctx.Err() and calling Wait, which would be a missed wake up.
+func (q *BlockingQueue[T]) wakeOnDone(ctx context.Context, c *sync.Cond) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		c.Broadcast()
+	})
+}
+
 func condBroadcast() {
 	type Button struct {
 		Clicked *sync.Cond
@@ -211,6 +549,239 @@ func condBroadcast() {
 	btnClickWg.Wait()       // Wait for all events to complete
 }
 
+func eventBus() {
+	// condBroadcast's subscribers get a single click, without knowing where it was, and can't stop listening.
+	// Bus fixes all three: a subscription lasts until cancelled, and every event carries a payload.
+	type Click struct {
+		X, Y int
+	}
+	bus := NewBus[Click]()
+
+	// Sync subscribers run in the goroutine calling Publish, before it returns.
+	maximize := bus.Subscribe("button", func(c Click) {
+		fmt.Printf("Window maximized (click at %d/%d)\n", c.X, c.Y)
+	}, SubscribeOptions{})
+
+	// Async subscribers run in their own goroutine, Publish only queues the event.
+	var popups sync.WaitGroup
+	popups.Add(3)
+	bus.Subscribe("button", func(c Click) {
+		defer popups.Done()
+		fmt.Printf("Annoying popup shows up (click at %d/%d)\n", c.X, c.Y)
+	}, SubscribeOptions{Async: true, Policy: Buffer})
+
+	// A slow subscriber with room for a single event: the clicks arriving while it's busy are dropped.
+	slow := bus.Subscribe("button", func(c Click) {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Printf("Colors have changed (click at %d/%d)\n", c.X, c.Y)
+	}, SubscribeOptions{Async: true, Size: 1, Policy: Drop})
+
+	for i := 1; i <= 3; i++ {
+		bus.Publish("button", Click{i, i})
+		if i == 1 {
+			maximize.Cancel() // once is enough
+		}
+	}
+	bus.Publish("other-button", Click{}) // no subscribers, nothing happens
+
+	popups.Wait()
+	bus.Close() // waits for the async subscribers to deliver what they have queued
+	fmt.Printf("Slow subscriber dropped %d clicks\n", slow.Dropped())
+}
+
+// SlowPolicy decides what Publish does when an async subscriber's queue is full.
+type SlowPolicy int
+
+const (
+	Block  SlowPolicy = iota // wait for room, a slow subscriber slows the publisher down
+	Drop                     // drop the event, the subscriber misses it
+	Buffer                   // queue it anyway, the queue grows without limit
+)
+
+type SubscribeOptions struct {
+	Async  bool       // deliver from a goroutine of the subscription instead of the publisher's
+	Size   int        // size of the queue of an async subscription, 16 if 0
+	Policy SlowPolicy // what to do when the queue is full
+}
+
+// Bus delivers events of type T, published on topics, to the subscribers of the topics.
+//
+// Every subscriber gets the events of its topic in the order they were published (by a single goroutine, events
+// published concurrently have no order to keep). A sync subscriber is called by Publish itself; an async one has its
+// own queue and goroutine, so a slow subscriber never delays the others, and SlowPolicy decides how much it can
+// delay the publisher.
+type Bus[T any] struct {
+	mu     sync.RWMutex
+	topics map[string][]*Subscription[T]
+	closed bool
+	wg     sync.WaitGroup // the goroutines of the async subscriptions
+}
+
+// Subscription is a subscriber of a Bus. Like condSignal, the queue of an async subscription is a slice and a
+// sync.Cond: the publisher waits on it when the queue is full (Block), the subscriber's goroutine when it's empty.
+type Subscription[T any] struct {
+	bus   *Bus[T]
+	topic string
+	fn    func(T)
+	opts  SubscribeOptions
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []T
+	stopped bool
+	dropped int
+}
+
+func NewBus[T any]() *Bus[T] {
+	return &Bus[T]{topics: make(map[string][]*Subscription[T])}
+}
+
+// Subscribe calls fn with every event published on topic, until the subscription is cancelled or the bus closed.
+func (b *Bus[T]) Subscribe(topic string, fn func(T), opts SubscribeOptions) *Subscription[T] {
+	if opts.Size <= 0 {
+		opts.Size = 16
+	}
+	s := &Subscription[T]{bus: b, topic: topic, fn: fn, opts: opts}
+	s.cond = sync.NewCond(&s.mu)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.stopped = true
+		return s
+	}
+
+	b.topics[topic] = append(b.topics[topic], s)
+	if opts.Async {
+		b.wg.Add(1)
+		go s.run()
+	}
+	return s
+}
+
+// Publish delivers event to the subscribers of topic, in the order they subscribed.
+func (b *Bus[T]) Publish(topic string, event T) {
+	// Copy the subscribers and release the lock before delivering: a sync subscriber can then subscribe or cancel
+	// without deadlocking, and a blocked publisher doesn't keep others from publishing.
+	b.mu.RLock()
+	subs := append([]*Subscription[T](nil), b.topics[topic]...)
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		s.deliver(event)
+	}
+}
+
+// Close cancels every subscription, and waits for the async ones to deliver the events already queued.
+func (b *Bus[T]) Close() {
+	b.mu.Lock()
+	b.closed = true
+	topics := b.topics
+	b.topics = make(map[string][]*Subscription[T])
+	b.mu.Unlock()
+
+	for _, subs := range topics {
+		for _, s := range subs {
+			s.stop(false)
+		}
+	}
+	b.wg.Wait()
+}
+
+// Cancel stops the subscription, events still queued are not delivered. It can be called from fn.
+func (s *Subscription[T]) Cancel() {
+	b := s.bus
+	b.mu.Lock()
+	subs := b.topics[s.topic]
+	for i, other := range subs {
+		if other == s {
+			// A new slice, Publish may be walking a copy of the old one.
+			b.topics[s.topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+
+	s.stop(true)
+}
+
+// Dropped returns the number of events dropped by the Drop policy.
+func (s *Subscription[T]) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Subscription[T]) deliver(event T) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	if !s.opts.Async {
+		// Unlocked while calling fn, it may cancel its own subscription.
+		s.mu.Unlock()
+		s.fn(event)
+		return
+	}
+	defer s.mu.Unlock()
+
+	for len(s.queue) >= s.opts.Size && !s.stopped {
+		switch s.opts.Policy {
+		case Drop:
+			s.dropped++
+			return
+		case Buffer:
+			s.queue = append(s.queue, event)
+			s.cond.Broadcast()
+			return
+		default:
+			s.cond.Wait() // Block, until the subscriber takes an event or is stopped
+		}
+	}
+	if s.stopped {
+		return
+	}
+	s.queue = append(s.queue, event)
+	s.cond.Broadcast() // the subscriber, and maybe publishers waiting for room: Broadcast, not Signal
+}
+
+// stop ends the subscription. discard drops the queued events, otherwise the goroutine delivers them first.
+func (s *Subscription[T]) stop(discard bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	if discard {
+		s.queue = nil
+	}
+	s.cond.Broadcast()
+}
+
+// run is the goroutine of an async subscription.
+func (s *Subscription[T]) run() {
+	defer s.bus.wg.Done()
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return // stopped, and nothing left to deliver
+		}
+		event := s.queue[0]
+		var zero T
+		s.queue[0] = zero
+		s.queue = s.queue[1:]
+		s.cond.Broadcast() // room for a blocked publisher
+		s.mu.Unlock()
+
+		s.fn(event)
+	}
+}
+
 func once() {
 	var o sync.Once
 	// sync.Once ensures that only one call to Do ever call the function passed in.
@@ -238,6 +809,190 @@ func once() {
 	fmt.Println(count) // will display 1 instead of 10
 }
 
+func onceErr() {
+	// sync.Once runs its function once, whether it worked or not: if connecting to the database fails, every later
+	// Do is a no-op and the program is stuck without a connection. OnceErr only keeps a success, a failure is retried
+	// by the next Do - after a backoff, so a thousand callers don't hammer a server that's down.
+	var attempts int
+	connect := func() (string, error) {
+		attempts++ // Do runs one call at a time, no need for a lock
+		if attempts < 3 {
+			return "", fmt.Errorf("attempt %d: connection refused", attempts)
+		}
+		return "connection", nil
+	}
+
+	o := OnceErr[string]{Backoff: 5 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	for i := 0; i < 6; i++ {
+		conn, err := o.Do(connect)
+		fmt.Printf("Do %d: %q %v\n", i, conn, err)
+		time.Sleep(4 * time.Millisecond)
+	}
+	fmt.Println("Attempts:", attempts)
+
+	// Callers arriving during an attempt share its result, even a failure, instead of each trying again in turn.
+	var shared OnceErr[string]
+	var sharedAttempts atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			defer wg.Done()
+			shared.Do(func() (string, error) {
+				sharedAttempts.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return "", errors.New("connection refused")
+			})
+		}()
+	}
+	wg.Wait()
+	fmt.Println("5 concurrent Dos, attempts:", sharedAttempts.Load())
+
+	// One lazily created resource per tenant: concurrent Dos for the same tenant wait for the same call, different
+	// tenants don't wait for each other.
+	var clients OnceMap[string, string]
+	var created atomic.Int32
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			defer wg.Done()
+			tenant := fmt.Sprintf("tenant-%d", i%2)
+			clients.Do(tenant, func(tenant string) (string, error) {
+				created.Add(1)
+				return "client of " + tenant, nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	fmt.Println("Clients created:", created.Load())
+
+	clients.Reset("tenant-0") // e.g. between tests, the next Do creates it again
+}
+
+// ErrBackoff is returned, wrapping the last error, by a Do called before the backoff of the last failure is over.
+var ErrBackoff = errors.New("backing off")
+
+// OnceErr runs an initialization function until it succeeds once, and then returns its result forever.
+//
+// Like sync.Once, the function runs in a single goroutine at a time, callers of Do arriving meanwhile wait for it and
+// get its result, a failure included: they don't each try again in turn. The zero value retries right away, set
+// Backoff to wait between failed attempts.
+type OnceErr[T any] struct {
+	Backoff    time.Duration // wait after the first failure, doubled after every other one
+	MaxBackoff time.Duration // cap of the wait, no cap if 0
+
+	mu       sync.Mutex
+	done     bool
+	value    T
+	err      error     // of the last attempt
+	failures int       // in a row
+	retry    time.Time // no attempt before then
+
+	attempts atomic.Uint64 // calls of fn, read without mu to tell whether one ran while waiting for mu
+}
+
+// Do returns the cached result if an earlier fn succeeded, otherwise calls fn. While backing off after a failure, it
+// returns the last error without calling fn.
+func (o *OnceErr[T]) Do(fn func() (T, error)) (T, error) {
+	seen := o.attempts.Load()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.done {
+		return o.value, nil
+	}
+	var zero T
+	if o.attempts.Load() != seen && o.err != nil {
+		return zero, o.err // an attempt failed while we waited, it's ours too
+	}
+	if time.Now().Before(o.retry) {
+		return zero, fmt.Errorf("%w: %w", ErrBackoff, o.err)
+	}
+
+	v, err := fn()
+	o.attempts.Add(1)
+	if err != nil {
+		o.err = err
+		o.failures++
+		o.retry = time.Now().Add(o.backoff())
+		return zero, err
+	}
+
+	o.done, o.value, o.err, o.failures = true, v, nil, 0
+	return v, nil
+}
+
+// Done reports whether an attempt succeeded.
+func (o *OnceErr[T]) Done() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.done
+}
+
+// Reset forgets the result, and any backoff: the next Do calls its function again. It's meant for tests, and for
+// values known to be stale (e.g. a closed connection).
+func (o *OnceErr[T]) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var zero T
+	o.done, o.value, o.err, o.failures, o.retry = false, zero, nil, 0, time.Time{}
+}
+
+// backoff returns the wait after o.failures failures in a row.
+func (o *OnceErr[T]) backoff() time.Duration {
+	if o.Backoff <= 0 {
+		return 0
+	}
+	d := o.Backoff
+	for i := 1; i < o.failures && d*2 > d; i++ { // d*2 > d stops before overflowing
+		d *= 2
+	}
+	if o.MaxBackoff > 0 && d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+// OnceMap is an OnceErr per key, created on first use. The zero value is ready to use, with no backoff.
+type OnceMap[K comparable, V any] struct {
+	Backoff, MaxBackoff time.Duration // of every key, see OnceErr
+
+	mu   sync.Mutex
+	keys map[K]*OnceErr[V]
+}
+
+// Do runs fn(key) until it succeeds once for key. Only the OnceErr of key is locked while fn runs, the map lock is
+// held just long enough to find it.
+func (m *OnceMap[K, V]) Do(key K, fn func(key K) (V, error)) (V, error) {
+	m.mu.Lock()
+	if m.keys == nil {
+		m.keys = make(map[K]*OnceErr[V])
+	}
+	o, ok := m.keys[key]
+	if !ok {
+		o = &OnceErr[V]{Backoff: m.Backoff, MaxBackoff: m.MaxBackoff}
+		m.keys[key] = o
+	}
+	m.mu.Unlock()
+
+	return o.Do(func() (V, error) { return fn(key) })
+}
+
+// Reset forgets the result of key. A Do of key already running keeps its OnceErr, and its result.
+func (m *OnceMap[K, V]) Reset(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, key)
+}
+
+// ResetAll forgets every key.
+func (m *OnceMap[K, V]) ResetAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = nil
+}
+
 func poolEx1() {
 	// Pool is a concurrent-safe implementation of the object pool pattern.
 	// At a high level, the pool pattern is a way to create and make available a fixed number, or pool, of things for use.
@@ -245,5 +1000,354 @@ func poolEx1() {
 	// only a fixed number of them are ever created, but an indeterminate number of operations can still request
 	// access to these things.
 
-	// TODO write example
+	// Pool below is that pattern, for anything: here fake database connections, at most 2 open at a time.
+	var opened atomic.Int32
+	p, err := NewPool(PoolConfig[*fakeConn]{
+		New: func(ctx context.Context) (*fakeConn, error) {
+			// New is called by many goroutines at once, the pool doesn't hold any lock while opening.
+			return &fakeConn{id: int(opened.Add(1))}, nil
+		},
+		Check:       (*fakeConn).Ping,
+		MaxOpen:     2,
+		MaxIdle:     1,
+		IdleTimeout: time.Second,
+	})
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			// Don't wait forever for a connection, give up after 50ms.
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			conn, err := p.Get(ctx)
+			if err != nil {
+				fmt.Printf("Query %d: %s\n", i, err)
+				return
+			}
+			time.Sleep(30 * time.Millisecond) // the query, the 5th Get has to wait for 2 of them and gives up
+			fmt.Printf("Query %d on connection %d\n", i, conn.id)
+			if i == 0 {
+				conn.broken = true // the next Get notices it with Check and opens a new one
+			}
+			p.Put(conn)
+		}(i)
+	}
+	wg.Wait()
+
+	fmt.Printf("%+v\n", p.Stats())
+}
+
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolConfig configures a Pool of T. Only New is required.
+type PoolConfig[T any] struct {
+	New     func(ctx context.Context) (T, error) // opens a new T
+	Check   func(v T) error                      // health check of an idle T before handing it out, nil skips it
+	Destroy func(v T)                            // closes a T the pool doesn't want anymore, nil does nothing
+
+	MaxOpen     int           // maximum number of T open at the same time, idle or in use
+	MaxIdle     int           // maximum number of idle T kept for reuse, the others are destroyed when put back
+	IdleTimeout time.Duration // idle T older than this are destroyed instead of reused, 0 keeps them forever
+}
+
+// Pool hands out at most MaxOpen values of T. When they are all in use, Get waits for one to be put back, for as
+// long as its context lets it.
+//
+// The limit is a semaphore: a buffered channel with MaxOpen slots, a Get takes one and a Put gives it back. Waiting
+// on a channel, unlike on a Mutex, can be given up with a select on ctx.Done().
+type Pool[T any] struct {
+	cfg   PoolConfig[T]
+	slots chan struct{}
+	done  chan struct{} // closed by Close, wakes up every waiting Get
+
+	mu     sync.Mutex
+	idle   []idleValue[T] // most recently put back last
+	closed bool
+	stats  PoolStats
+}
+
+type idleValue[T any] struct {
+	v     T
+	since time.Time
+}
+
+// PoolStats tells how a Pool is doing, e.g. many waits mean MaxOpen is too low.
+type PoolStats struct {
+	Open         int           // values open, in use and idle
+	InUse        int           // values handed out and not put back yet
+	Idle         int           // values waiting to be reused
+	Waits        int           // Gets that had to wait for a value
+	WaitDuration time.Duration // total time spent waiting
+	Timeouts     int           // Gets that gave up waiting
+}
+
+func NewPool[T any](cfg PoolConfig[T]) (*Pool[T], error) {
+	if cfg.New == nil {
+		return nil, errors.New("pool: New is required")
+	}
+	if cfg.MaxOpen <= 0 {
+		return nil, fmt.Errorf("pool: MaxOpen is %d", cfg.MaxOpen)
+	}
+	if cfg.MaxIdle < 0 || cfg.MaxIdle > cfg.MaxOpen {
+		cfg.MaxIdle = cfg.MaxOpen
+	}
+
+	p := Pool[T]{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxOpen),
+		done:  make(chan struct{}),
+	}
+	return &p, nil
+}
+
+// Get returns an idle value, or a new one. When MaxOpen values are in use it waits until one is put back, ctx is
+// done or the pool is closed. Every value returned must be given back with Put or Discard.
+func (p *Pool[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		// All taken, wait. The fast path above keeps Gets that don't wait out of the stats.
+		start := time.Now()
+		select {
+		case p.slots <- struct{}{}:
+			p.waited(start, false)
+		case <-ctx.Done():
+			p.waited(start, true)
+			return zero, ctx.Err()
+		case <-p.done:
+			return zero, ErrPoolClosed
+		}
+	}
+
+	for {
+		v, ok, err := p.takeIdle()
+		if err != nil {
+			<-p.slots
+			return zero, err
+		}
+		if !ok {
+			break
+		}
+		if p.cfg.Check == nil || p.cfg.Check(v) == nil {
+			return v, nil
+		}
+		p.destroy(v) // broken, try the next idle one
+	}
+
+	v, err := p.cfg.New(ctx)
+	if err != nil {
+		<-p.slots
+		return zero, err
+	}
+	return v, nil
+}
+
+// Put gives v back to the pool, to be reused. Values the pool has no room for are destroyed.
+func (p *Pool[T]) Put(v T) {
+	p.mu.Lock()
+	keep := !p.closed && len(p.idle) < p.cfg.MaxIdle
+	if keep {
+		p.idle = append(p.idle, idleValue[T]{v, time.Now()})
+	}
+	p.mu.Unlock()
+
+	if !keep {
+		p.destroy(v)
+	}
+	<-p.slots
+}
+
+// Discard gives v back to the pool without reusing it, e.g. a connection that failed halfway through a query.
+func (p *Pool[T]) Discard(v T) {
+	p.destroy(v)
+	<-p.slots
+}
+
+func (p *Pool[T]) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.stats
+	s.Idle = len(p.idle)
+	s.InUse = len(p.slots)
+	s.Open = s.Idle + s.InUse
+	return s
+}
+
+// Close destroys the idle values and makes every Get fail. Values in use are destroyed when they are put back.
+func (p *Pool[T]) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	close(p.done)
+	for _, iv := range idle {
+		p.destroy(iv.v)
+	}
+}
+
+// takeIdle pops the most recently used idle value, destroying the ones idle for too long on the way.
+func (p *Pool[T]) takeIdle() (T, bool, error) {
+	var expired []T
+	defer func() {
+		// Destroying can be slow (closing a connection), do it without holding the lock.
+		for _, v := range expired {
+			p.destroy(v)
+		}
+	}()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var zero T
+	if p.closed {
+		return zero, false, ErrPoolClosed
+	}
+
+	for len(p.idle) > 0 {
+		iv := p.idle[len(p.idle)-1]
+		p.idle[len(p.idle)-1] = idleValue[T]{} // don't keep v reachable from the backing array
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.cfg.IdleTimeout > 0 && time.Since(iv.since) > p.cfg.IdleTimeout {
+			expired = append(expired, iv.v)
+			continue
+		}
+		return iv.v, true, nil
+	}
+	return zero, false, nil
+}
+
+func (p *Pool[T]) waited(start time.Time, timeout bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.Waits++
+	p.stats.WaitDuration += time.Since(start)
+	if timeout {
+		p.stats.Timeouts++
+	}
+}
+
+func (p *Pool[T]) destroy(v T) {
+	if p.cfg.Destroy != nil {
+		p.cfg.Destroy(v)
+	}
+}
+
+// fakeConn stands for a database connection in poolEx1.
+type fakeConn struct {
+	id     int
+	broken bool
+}
+
+func (c *fakeConn) Ping() error {
+	if c.broken {
+		return fmt.Errorf("connection %d is broken", c.id)
+	}
+	return nil
+}
+
+func poolEx2() {
+	// sync.Pool is the standard library's pool, but it's not the pool of poolEx1: it doesn't cap anything, and the
+	// values in it can be dropped at any time, the GC empties it. It's a cache of allocated memory, made to take
+	// pressure off the garbage collector (see ultimate-go/garbage-collector): fewer allocations means the heap grows
+	// slower, and the GC runs less often and has less to mark.
+	// The typical use is a buffer needed for the duration of a call, e.g. to encode a response, by many goroutines.
+	bp := NewBufferPool()
+
+	render := func(name string) string {
+		buf := bp.Get(64)
+		defer bp.Put(buf) // after String below, which copies the bytes out of buf
+
+		buf.WriteString("Hello, ")
+		buf.WriteString(name)
+		return buf.String()
+	}
+	fmt.Println(render("Gopher"))
+
+	// TestBufferPoolAllocs in the _test.go file counts what the pool saves, and BenchmarkBufferPool measures it:
+	// go test -bench BufferPool "5. sync-package.go" "5. sync-package_test.go"
+
+	// A buffer grown past the largest size class is not kept, or one huge request would pin that memory forever.
+	big := bp.Get(0)
+	big.Grow(4 << 20)
+	bp.Put(big)
+	fmt.Printf("Kept %d buffers, dropped %d too large\n", bp.kept.Load(), bp.dropped.Load())
+}
+
+// bufferClasses are the capacities of the buffers a BufferPool hands out. A buffer asked for n bytes comes from the
+// smallest class that fits, so a 100 bytes buffer never takes a 64KB one, and the other way around.
+var bufferClasses = []int{512, 4 << 10, 64 << 10}
+
+// BufferPool is a set of sync.Pools of bytes.Buffer, one per size class.
+type BufferPool struct {
+	pools []sync.Pool // pools[i] holds buffers with a capacity of at least bufferClasses[i]
+
+	kept, dropped atomic.Int64
+}
+
+func NewBufferPool() *BufferPool {
+	bp := BufferPool{pools: make([]sync.Pool, len(bufferClasses))}
+	for i := range bp.pools {
+		size := bufferClasses[i]
+		// New is called by Get when the pool is empty. It returns a pointer: putting a bytes.Buffer value in a
+		// sync.Pool would copy it into an interface, which allocates, the very thing we want to avoid.
+		bp.pools[i].New = func() any {
+			return bytes.NewBuffer(make([]byte, 0, size))
+		}
+	}
+	return &bp
+}
+
+// Get returns an empty buffer with room for at least size bytes. Larger sizes than the largest class get a buffer
+// of the largest class, it grows as needed.
+func (bp *BufferPool) Get(size int) *bytes.Buffer {
+	i := 0
+	for i < len(bufferClasses)-1 && bufferClasses[i] < size {
+		i++
+	}
+	return bp.pools[i].Get().(*bytes.Buffer)
+}
+
+// Put resets buf and gives it back to the pool of the class it fits in. Buffers that grew larger than twice the
+// largest class are dropped, for the GC to collect, so the memory held by the pool stays bounded.
+// buf must not be used after Put.
+func (bp *BufferPool) Put(buf *bytes.Buffer) {
+	c := buf.Cap()
+	if c > 2*bufferClasses[len(bufferClasses)-1] {
+		bp.dropped.Add(1)
+		return
+	}
+
+	// The largest class whose size the buffer can hold, so Get can trust the capacity of what it takes out.
+	i := len(bufferClasses) - 1
+	for i >= 0 && bufferClasses[i] > c {
+		i--
+	}
+	if i < 0 {
+		bp.dropped.Add(1) // smaller than any class, only a buffer not made by the pool can be
+		return
+	}
+
+	buf.Reset()
+	bp.pools[i].Put(buf)
+	bp.kept.Add(1)
 }
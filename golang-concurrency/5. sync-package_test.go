@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The lessons are run one file at a time, run the tests and benchmarks with the file they test:
+//
+//	go test -race "5. sync-package.go" "5. sync-package_test.go"
+//	go test -bench . "5. sync-package.go" "5. sync-package_test.go"
+
+// BenchmarkCache compares Cache, guarded by a RWMutex, with a Mutex and a sync.Map, for a growing share of reads.
+// RunParallel runs the benchmark on GOMAXPROCS goroutines, which is what makes the locks contended. With a single CPU
+// nothing runs in parallel, and the results only show the cost of each lock (and of the TTL check of Cache). Expect
+// different winners on different machines.
+func BenchmarkCache(b *testing.B) {
+	type cache interface {
+		Get(key string) (int, bool)
+		Set(key string, value int)
+	}
+
+	const keys = 1024
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = strconv.Itoa(i)
+	}
+
+	bench := func(b *testing.B, c cache, readPercent int) {
+		for _, k := range names {
+			c.Set(k, 0)
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				k := names[i%keys]
+				if i%100 < readPercent {
+					c.Get(k)
+				} else {
+					c.Set(k, i)
+				}
+				i++
+			}
+		})
+	}
+
+	for _, reads := range []int{50, 90, 99, 100} {
+		b.Run(fmt.Sprintf("reads=%d%%/RWMutex", reads), func(b *testing.B) {
+			c := NewCache[string, int](time.Minute, time.Minute)
+			defer c.Close()
+			bench(b, c, reads)
+		})
+		b.Run(fmt.Sprintf("reads=%d%%/Mutex", reads), func(b *testing.B) {
+			bench(b, &mutexCache[string, int]{entries: make(map[string]int)}, reads)
+		})
+		b.Run(fmt.Sprintf("reads=%d%%/sync.Map", reads), func(b *testing.B) {
+			bench(b, &syncMapCache[string, int]{}, reads)
+		})
+	}
+}
+
+// mutexCache is Cache with the sync.Mutex of mutex(), without the TTL, to compare the locks alone.
+type mutexCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]V
+}
+
+func (c *mutexCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+func (c *mutexCache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
+
+// syncMapCache is sync.Map behind the same methods. sync.Map is optimized for keys written once and read many times,
+// or for goroutines working on disjoint sets of keys.
+type syncMapCache[K comparable, V any] struct {
+	m sync.Map
+}
+
+func (c *syncMapCache[K, V]) Get(key K) (V, bool) {
+	v, ok := c.m.Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return v.(V), true
+}
+
+func (c *syncMapCache[K, V]) Set(key K, value V) {
+	c.m.Store(key, value)
+}
+
+// TestBlockingQueueExactlyOnce has many producers and consumers on a tiny queue, some of them with timeouts, and a
+// Close in the middle of it all. Every value put must be taken exactly once, by a Take or by the final Drain.
+func TestBlockingQueueExactlyOnce(t *testing.T) {
+	const producers, consumers, perProducer = 8, 8, 2000
+	q := NewBlockingQueue[int](4)
+
+	// put[v] is set when Put or TryPut of v succeeded, taken[v] counts how many times v came out.
+	put := make([]atomic.Bool, producers*perProducer)
+	taken := make([]atomic.Int32, producers*perProducer)
+
+	var prod sync.WaitGroup
+	prod.Add(producers)
+	for p := 0; p < producers; p++ {
+		go func(p int) {
+			defer prod.Done()
+			for i := 0; i < perProducer; i++ {
+				v := p*perProducer + i
+
+				var err error
+				if i%3 == 0 {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
+					err = q.Put(ctx, v)
+					cancel()
+				} else if !q.TryPut(v) {
+					err = q.Put(context.Background(), v)
+				}
+				if errors.Is(err, ErrQueueClosed) {
+					return
+				}
+				if err == nil {
+					put[v].Store(true)
+				}
+			}
+		}(p)
+	}
+
+	var cons sync.WaitGroup
+	cons.Add(consumers)
+	for c := 0; c < consumers; c++ {
+		go func() {
+			defer cons.Done()
+			for {
+				v, err := q.Take(context.Background())
+				if err != nil {
+					return // closed and empty
+				}
+				taken[v].Add(1)
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	q.Close()
+	prod.Wait()
+	cons.Wait()
+	for _, v := range q.Drain() {
+		taken[v].Add(1)
+	}
+
+	n := 0
+	for v := range put {
+		want := int32(0)
+		if put[v].Load() {
+			want = 1
+			n++
+		}
+		if got := taken[v].Load(); got != want {
+			t.Errorf("value %d: put %v, taken %d times", v, put[v].Load(), got)
+		}
+	}
+	if n == 0 {
+		t.Error("no value was put")
+	}
+}
+
+func TestBlockingQueueCloseWakesWaiters(t *testing.T) {
+	empty := NewBlockingQueue[int](1)
+	full := NewBlockingQueue[int](1)
+	full.Put(context.Background(), 1)
+
+	const waiters = 4
+	errs := make(chan error, 2*waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			_, err := empty.Take(context.Background())
+			errs <- err
+		}()
+		go func() { errs <- full.Put(context.Background(), 2) }()
+	}
+
+	time.Sleep(10 * time.Millisecond) // let them all wait
+	empty.Close()
+	full.Close()
+	for i := 0; i < 2*waiters; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrQueueClosed) {
+				t.Errorf("woke up with %v, want %v", err, ErrQueueClosed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d waiters still blocked after Close", 2*waiters-i)
+		}
+	}
+
+	// What was in the queue is still there to take.
+	if v, err := full.Take(context.Background()); v != 1 || err != nil {
+		t.Errorf("Take after Close = %d, %v, want 1, nil", v, err)
+	}
+}
+
+func TestBlockingQueueContext(t *testing.T) {
+	q := NewBlockingQueue[int](1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	taken := make(chan error, 1)
+	go func() {
+		_, err := q.Take(ctx)
+		taken <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // let it wait
+	cancel()
+	select {
+	case err := <-taken:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Take: %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Take still blocked after cancel")
+	}
+
+	q.Put(context.Background(), 1)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Put(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Put on a full queue: %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := q.Drain(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("queue holds %v, want [1]", got)
+	}
+}
+
+// fakePool returns a Pool of fakeConn, and the ids of the connections it destroyed so far.
+func fakePool(t *testing.T, maxOpen, maxIdle int) (*Pool[*fakeConn], func() []int) {
+	t.Helper()
+	var mu sync.Mutex
+	var opened int
+	var destroyed []int
+
+	p, err := NewPool(PoolConfig[*fakeConn]{
+		New: func(ctx context.Context) (*fakeConn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			opened++
+			return &fakeConn{id: opened}, nil
+		},
+		Check: (*fakeConn).Ping,
+		Destroy: func(c *fakeConn) {
+			mu.Lock()
+			defer mu.Unlock()
+			destroyed = append(destroyed, c.id)
+		},
+		MaxOpen: maxOpen,
+		MaxIdle: maxIdle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+
+	return p, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), destroyed...)
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	p, destroyed := fakePool(t, 2, 2)
+	ctx := context.Background()
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(c)
+	again, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != c {
+		t.Fatalf("got connection %d, want %d back", again.id, c.id)
+	}
+
+	// A broken connection fails Check, it's destroyed and a new one is opened.
+	again.broken = true
+	p.Put(again)
+	fresh, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh == c || fresh.id != 2 {
+		t.Fatalf("got connection %d, want a new one", fresh.id)
+	}
+	if d := destroyed(); len(d) != 1 || d[0] != c.id {
+		t.Fatalf("destroyed %v, want [%d]", d, c.id)
+	}
+	if s := p.Stats(); s.InUse != 1 || s.Idle != 0 || s.Open != 1 {
+		t.Fatalf("stats %+v, want 1 in use", s)
+	}
+}
+
+func TestPoolMaxIdle(t *testing.T) {
+	p, destroyed := fakePool(t, 3, 1)
+	ctx := context.Background()
+
+	conns := make([]*fakeConn, 3)
+	for i := range conns {
+		c, err := p.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c
+	}
+
+	// All 3 in use, the 4th Get waits and gives up.
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get over MaxOpen: %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	for _, c := range conns {
+		p.Put(c)
+	}
+	// Only 1 is kept, the first one put back, the others are destroyed.
+	if d := destroyed(); len(d) != 2 || d[0] != 2 || d[1] != 3 {
+		t.Fatalf("destroyed %v, want [2 3]", d)
+	}
+	if s := p.Stats(); s.Idle != 1 || s.InUse != 0 || s.Waits != 1 || s.Timeouts != 1 {
+		t.Fatalf("stats %+v, want 1 idle, 1 wait that timed out", s)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p, destroyed := fakePool(t, 2, 2)
+	ctx := context.Background()
+
+	a, _ := p.Get(ctx)
+	b, _ := p.Get(ctx)
+	p.Put(b) // idle
+
+	p.Close()
+	if d := destroyed(); len(d) != 1 || d[0] != b.id {
+		t.Fatalf("destroyed %v on Close, want the idle %d", d, b.id)
+	}
+	if _, err := p.Get(ctx); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Get after Close: %v, want %v", err, ErrPoolClosed)
+	}
+	p.Put(a) // in use during Close, destroyed now
+	if d := destroyed(); len(d) != 2 || d[1] != a.id {
+		t.Fatalf("destroyed %v, want %d too", d, a.id)
+	}
+	p.Close() // twice is fine
+
+	// Close wakes up a Get waiting for a connection.
+	p, _ = fakePool(t, 1, 1)
+	c, _ := p.Get(ctx)
+	got := make(chan error, 1)
+	go func() {
+		_, err := p.Get(ctx)
+		got <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // let it wait
+	p.Close()
+	select {
+	case err := <-got:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Fatalf("waiting Get: %v, want %v", err, ErrPoolClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get still waiting after Close")
+	}
+	p.Put(c)
+}
+
+// greeting keeps the results of the allocation counts alive, so the compiler can't optimize the allocations away.
+var greeting string
+
+// TestBufferPoolAllocs counts the allocations of a render like the one of poolEx2, with and without the pool.
+// testing.AllocsPerRun averages them over many runs. The pool only saves the buffer: String still allocates the string
+// it returns.
+func TestBufferPoolAllocs(t *testing.T) {
+	bp := NewBufferPool()
+	render := func(name string) string {
+		buf := bp.Get(64)
+		defer bp.Put(buf)
+
+		buf.WriteString("Hello, ")
+		buf.WriteString(name)
+		return buf.String()
+	}
+
+	withPool := testing.AllocsPerRun(1000, func() { greeting = render("Gopher") })
+	withoutPool := testing.AllocsPerRun(1000, func() {
+		var buf bytes.Buffer
+		buf.WriteString("Hello, ")
+		buf.WriteString("Gopher")
+		greeting = buf.String()
+	})
+	if withPool != 1 {
+		t.Errorf("%.0f allocations per call with the pool, want 1, the string", withPool)
+	}
+	if withoutPool <= withPool {
+		t.Errorf("%.0f allocations per call without the pool, want more than the %.0f with it", withoutPool, withPool)
+	}
+}
+
+// BenchmarkBufferPool does the same work, 4KB written to a buffer, with and without the pool. ReportAllocs adds the
+// allocations per operation to the result, and the GCs metric is the number of GC runs during the benchmark, which
+// is what the allocations cost.
+func BenchmarkBufferPool(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 4<<10)
+	size := len(payload)  // only known at run time, like most buffer sizes, so make allocates on the heap
+	var sink atomic.Int64 // keeps the compiler from optimizing the work away
+
+	bench := func(b *testing.B, fn func()) {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				fn()
+			}
+		})
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.NumGC-before.NumGC), "GCs")
+	}
+
+	b.Run("no pool", func(b *testing.B) {
+		bench(b, func() {
+			buf := bytes.NewBuffer(make([]byte, 0, size))
+			buf.Write(payload)
+			sink.Add(int64(buf.Len()))
+		})
+	})
+	b.Run("sync.Pool", func(b *testing.B) {
+		bp := NewBufferPool()
+		bench(b, func() {
+			buf := bp.Get(4 << 10)
+			buf.Write(payload)
+			sink.Add(int64(buf.Len()))
+			bp.Put(buf)
+		})
+	})
+}
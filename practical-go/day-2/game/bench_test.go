@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// The benchmarks compare the naive and grid collision checks. Run them with `go test -bench Collisions`.
+
+func BenchmarkCollisions(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		boxes := randomBoxes(n, maxX, maxY, 1)
+
+		b.Run(fmt.Sprintf("naive/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				naiveCollisions(boxes)
+			}
+		})
+		b.Run(fmt.Sprintf("grid/n=%d", n), func(b *testing.B) {
+			g := NewGrid(gridCellSize)
+			for i, r := range boxes {
+				g.Insert(ID(i), r)
+			}
+			if got, want := gridCollisions(g, boxes), naiveCollisions(boxes); got != want {
+				b.Fatalf("grid found %d pairs, naive %d", got, want)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				gridCollisions(g, boxes)
+			}
+		})
+	}
+}
+
+func randomBoxes(n, width, height int, seed int64) []Rect {
+	rnd := rand.New(rand.NewSource(seed))
+	boxes := make([]Rect, n)
+	for i := range boxes {
+		boxes[i] = Rect{rnd.Intn(width), rnd.Intn(height), 1 + rnd.Intn(playerSize), 1 + rnd.Intn(playerSize)}
+	}
+	return boxes
+}
+
+// naiveCollisions checks every pair of boxes, O(n²).
+func naiveCollisions(boxes []Rect) int {
+	pairs := 0
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			if boxes[i].Overlaps(boxes[j]) {
+				pairs++
+			}
+		}
+	}
+	return pairs
+}
+
+// gridCollisions does the same as naiveCollisions, but only looks at the boxes sharing a cell.
+func gridCollisions(g *Grid, boxes []Rect) int {
+	pairs := 0
+	for i, r := range boxes {
+		for _, id := range g.Query(r) {
+			if int(id) > i {
+				pairs++
+			}
+		}
+	}
+	return pairs
+}
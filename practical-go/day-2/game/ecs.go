@@ -0,0 +1,224 @@
+package main
+
+// An entity-component-system (ECS) is the alternative to building entities out of embedded structs.
+//
+// With embedding, Player embeds Item and gets its fields promoted, and the compiler never tells us when two embedded
+// types bring fields with the same name. Every new kind of entity is a new struct, and a slice of them is a slice of
+// pointers to values scattered all over the heap.
+//
+// With an ECS an entity is only an id. Its data lives in components (Position, Velocity, ...), each kind of component
+// stored in its own dense slice. A system is a function working on the entities that have the components it needs,
+// e.g. movement wants Position and Velocity. Walking a dense slice is what the CPU caches and prefetcher like best,
+// see BenchmarkMovement (go test -bench Movement).
+
+// EntityID identifies an entity of a Registry. 0 is never used, so it can mean "no entity".
+type EntityID uint32
+
+type Position struct {
+	X, Y float64
+}
+
+type Velocity struct {
+	X, Y float64
+}
+
+type Name struct {
+	Value string
+}
+
+type Health struct {
+	HP, Max int
+}
+
+// Store holds the components of type T, as a sparse set. The components themselves are packed in dense, with no
+// holes, and sparse maps an EntityID to its index in dense. Adding, getting and removing are O(1), and iterating only
+// touches the packed slice.
+type Store[T any] struct {
+	dense    []T
+	entities []EntityID // entities[i] owns dense[i]
+	sparse   []int32    // indexed by EntityID, index in dense + 1, 0 when the entity has no T
+}
+
+// Len returns the number of entities with a T.
+func (s *Store[T]) Len() int {
+	return len(s.dense)
+}
+
+// Set gives e the component v, replacing the one it had.
+func (s *Store[T]) Set(e EntityID, v T) {
+	if i, ok := s.index(e); ok {
+		s.dense[i] = v
+		return
+	}
+
+	for int(e) >= len(s.sparse) {
+		s.sparse = append(s.sparse, 0)
+	}
+	s.dense = append(s.dense, v)
+	s.entities = append(s.entities, e)
+	s.sparse[e] = int32(len(s.dense))
+}
+
+// Get returns a pointer to the component of e, valid until the next Set or Remove on s.
+func (s *Store[T]) Get(e EntityID) (*T, bool) {
+	i, ok := s.index(e)
+	if !ok {
+		return nil, false
+	}
+	return &s.dense[i], true
+}
+
+// Has reports whether e has a T.
+func (s *Store[T]) Has(e EntityID) bool {
+	_, ok := s.index(e)
+	return ok
+}
+
+// Remove takes the component away from e. The last component is moved in its place, so dense stays packed.
+func (s *Store[T]) Remove(e EntityID) {
+	i, ok := s.index(e)
+	if !ok {
+		return
+	}
+
+	last := len(s.dense) - 1
+	s.dense[i] = s.dense[last]
+	s.entities[i] = s.entities[last]
+	s.sparse[s.entities[i]] = int32(i + 1)
+
+	var zero T
+	s.dense[last] = zero // don't keep anything alive from the removed component
+	s.dense = s.dense[:last]
+	s.entities = s.entities[:last]
+	s.sparse[e] = 0
+}
+
+// Each calls fn for every component, in storage order. fn must not add or remove components of s.
+func (s *Store[T]) Each(fn func(e EntityID, v *T)) {
+	for i := range s.dense {
+		fn(s.entities[i], &s.dense[i])
+	}
+}
+
+func (s *Store[T]) index(e EntityID) (int, bool) {
+	if int(e) >= len(s.sparse) || s.sparse[e] == 0 {
+		return 0, false
+	}
+	return int(s.sparse[e] - 1), true
+}
+
+// Each2 calls fn for every entity that has both an A and a B. It walks the smaller store and looks the entities up in
+// the other one.
+func Each2[A, B any](a *Store[A], b *Store[B], fn func(e EntityID, a *A, b *B)) {
+	if a.Len() <= b.Len() {
+		for i, e := range a.entities {
+			if j, ok := b.index(e); ok {
+				fn(e, &a.dense[i], &b.dense[j])
+			}
+		}
+		return
+	}
+
+	for j, e := range b.entities {
+		if i, ok := a.index(e); ok {
+			fn(e, &a.dense[i], &b.dense[j])
+		}
+	}
+}
+
+// Registry creates entities and holds the stores of every component.
+type Registry struct {
+	Positions  Store[Position]
+	Velocities Store[Velocity]
+	Names      Store[Name]
+	Healths    Store[Health]
+
+	next  EntityID
+	alive []bool     // indexed by EntityID
+	free  []EntityID // ids of destroyed entities, reused before making new ones so sparse doesn't grow forever
+}
+
+// NewEntity returns an entity with no components.
+func (r *Registry) NewEntity() EntityID {
+	if n := len(r.free); n > 0 {
+		e := r.free[n-1]
+		r.free = r.free[:n-1]
+		r.alive[e] = true
+		return e
+	}
+
+	r.next++
+	for int(r.next) >= len(r.alive) {
+		r.alive = append(r.alive, false)
+	}
+	r.alive[r.next] = true
+	return r.next
+}
+
+// Alive reports whether e was created and not destroyed yet.
+func (r *Registry) Alive(e EntityID) bool {
+	return int(e) < len(r.alive) && r.alive[e]
+}
+
+// Destroy removes every component of e and lets its id be reused.
+func (r *Registry) Destroy(e EntityID) {
+	if !r.Alive(e) {
+		return
+	}
+
+	r.alive[e] = false
+	r.Positions.Remove(e)
+	r.Velocities.Remove(e)
+	r.Names.Remove(e)
+	r.Healths.Remove(e)
+	r.free = append(r.free, e)
+}
+
+// MovementSystem moves every entity with a Position and a Velocity by dt seconds.
+// It's the hottest system, so it walks the stores by hand instead of paying for a function call per entity in Each2.
+func MovementSystem(r *Registry, dt float64) {
+	ps, vs := &r.Positions, &r.Velocities
+	for i, e := range vs.entities {
+		if j, ok := ps.index(e); ok {
+			v, p := &vs.dense[i], &ps.dense[j]
+			p.X += v.X * dt
+			p.Y += v.Y * dt
+		}
+	}
+}
+
+// BoundsSystem keeps every Position inside a width x height world, bouncing the ones that have a Velocity.
+func BoundsSystem(r *Registry, width, height int) {
+	maxX, maxY := float64(width-1), float64(height-1)
+	r.Positions.Each(func(e EntityID, p *Position) {
+		v, moving := r.Velocities.Get(e)
+		if p.X < 0 || p.X > maxX {
+			p.X = clampFloat(p.X, 0, maxX)
+			if moving {
+				v.X = -v.X
+			}
+		}
+		if p.Y < 0 || p.Y > maxY {
+			p.Y = clampFloat(p.Y, 0, maxY)
+			if moving {
+				v.Y = -v.Y
+			}
+		}
+	})
+}
+
+// ReapSystem destroys every entity whose Health dropped to 0 or less, and returns them.
+func ReapSystem(r *Registry) []EntityID {
+	var dead []EntityID
+	r.Healths.Each(func(e EntityID, h *Health) {
+		if h.HP <= 0 {
+			dead = append(dead, e)
+		}
+	})
+
+	// Not from inside Each, Destroy moves components around in the store being walked.
+	for _, e := range dead {
+		r.Destroy(e)
+	}
+	return dead
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// BenchmarkMovement compares moving embedded entities and moving an ECS, run it with `go test -bench Movement`.
+//
+// "fresh" is both layouts as they are right after creating the entities in order: the embedded ones were allocated one
+// after the other, so walking the slice walks memory in order too, and so does walking the ECS stores.
+// "churned" is both after entities came and went for a while: the embedded slice points all over the heap, and the
+// ECS stores got their components in different orders, so a system reading two of them jumps around in the second
+// one. Compare each layout with the other in the same state: with few entities everything fits in the cache and the
+// embedded ones, with no index lookup, are as fast or faster. The ECS pulls ahead once they don't fit anymore.
+func BenchmarkMovement(b *testing.B) {
+	for _, churned := range []bool{false, true} {
+		layout := "fresh"
+		if churned {
+			layout = "churned"
+		}
+
+		for _, n := range []int{1000, 10000, 100000} {
+			b.Run(fmt.Sprintf("%s/embedded/n=%d", layout, n), func(b *testing.B) {
+				es := newEmbeddedEntities(n, churned)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					moveEmbedded(es, 0.1)
+				}
+			})
+			b.Run(fmt.Sprintf("%s/ecs/n=%d", layout, n), func(b *testing.B) {
+				r := newECSEntities(n, churned)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					MovementSystem(r, 0.1)
+				}
+			})
+		}
+	}
+}
+
+// embeddedEntity is an entity built the embedding way, every field promoted from what it embeds.
+type embeddedEntity struct {
+	Player
+	Vel    Velocity
+	Health Health
+	PX, PY float64
+}
+
+// newEmbeddedEntities allocates the entities one by one, like a game creating entities over time does. With churned
+// the slice is then shuffled: once entities come and go, the order of the slice has nothing to do with where they are
+// in memory.
+func newEmbeddedEntities(n int, churned bool) []*embeddedEntity {
+	rnd := rand.New(rand.NewSource(1))
+	es := make([]*embeddedEntity, n)
+	for i := range es {
+		es[i] = &embeddedEntity{
+			Player: Player{Name: fmt.Sprintf("entity-%d", i)},
+			Vel:    Velocity{rnd.Float64(), rnd.Float64()},
+			Health: Health{100, 100},
+		}
+	}
+	if churned {
+		rnd.Shuffle(len(es), func(i, j int) { es[i], es[j] = es[j], es[i] })
+	}
+	return es
+}
+
+func moveEmbedded(es []*embeddedEntity, dt float64) {
+	for _, e := range es {
+		e.PX += e.Vel.X * dt
+		e.PY += e.Vel.Y * dt
+	}
+}
+
+// newECSEntities is newEmbeddedEntities for a Registry. With churned the velocities are set in a shuffled order, so
+// the Velocities and Positions stores no longer list the entities in the same order.
+func newECSEntities(n int, churned bool) *Registry {
+	rnd := rand.New(rand.NewSource(1))
+	var r Registry
+	es := make([]EntityID, n)
+	for i := range es {
+		es[i] = r.NewEntity()
+		r.Names.Set(es[i], Name{fmt.Sprintf("entity-%d", i)})
+		r.Positions.Set(es[i], Position{})
+		r.Healths.Set(es[i], Health{100, 100})
+	}
+	if churned {
+		rnd.Shuffle(len(es), func(i, j int) { es[i], es[j] = es[j], es[i] })
+	}
+	for _, e := range es {
+		r.Velocities.Set(e, Velocity{rnd.Float64(), rnd.Float64()})
+	}
+	return &r
+}
@@ -1,8 +1,42 @@
 package main
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 func main() {
+	addr := flag.String("serve", "", "run the game server on `addr`, e.g. localhost:7777")
+	render := flag.Bool("render", false, "watch a game in the terminal until interrupted")
+	scores := flag.String("leaderboard", "leaderboard.json", "keep the best scores of -render games in `file`")
+	npcs := flag.String("npcs", "", "load the NPC brains of -render games from `file`, instead of the default ones")
+	flag.Parse()
+
+	if *render {
+		if err := watch(*scores, *npcs); err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatalf("error: %s", err)
+		}
+		return
+	}
+
+	if *addr != "" {
+		if err := serve(*addr); err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatalf("error: %s", err)
+		}
+		return
+	}
+
 	var i1 Item
 	fmt.Printf("i1 -> %#v %d\n", i1, i1)
 
@@ -25,9 +59,9 @@ func main() {
 		Name: "Karim",
 		Item: Item{200, 300},
 	}
-	fmt.Printf("p1 -> %#v %d \n p1.X: %d", p1, p1, p1.X)
+	fmt.Printf("p1 -> %#v %v \n p1.X: %d", p1, p1, p1.X)
 	p1.Move(400, 600)
-	fmt.Printf("p1 (move) -> %d\n", p1)
+	fmt.Printf("p1 (move) -> %v\n", p1)
 
 	ms := []Mover{
 		&i1,
@@ -38,8 +72,403 @@ func main() {
 	}
 
 	moveAll(ms, 0, 0)
+
+	// Calling Move directly skips any bounds check, p1 above ended up at 400/600, outside of the maxX/maxY area.
+	// A World owns the entities and every move goes through its Policy.
+	w, err := NewWorld(maxX, maxY, Clamp)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	id, _ := w.Add(&p1)
+	w.Move(id, 5000, -20)
+	fmt.Printf("p1 (world move, %s) -> %v\n", w.Policy, p1)
+
+	w.Policy = Wrap
+	w.Move(id, maxX+1, -1)
+	fmt.Printf("p1 (world move, %s) -> %v\n", w.Policy, p1)
+
+	w.Policy = Reject
+	if err := w.Move(id, maxX, 0); err != nil {
+		fmt.Println("error:", err)
+	}
+
+	// The world keeps every entity in a spatial index, so it can tell who overlaps whom without checking every pair.
+	w.OnCollision(func(w *World, mover, other ID) {
+		fmt.Printf("collision: %d moved onto %d\n", mover, other)
+	})
+	i5 := Item{10, 10}
+	w.Add(&i5)
+	w.Move(id, 9, 9) // p1 is 2x2, so it now covers 10/10
+	if near, ok := w.Nearest(0, 0, nil); ok {
+		fmt.Printf("nearest to 0/0 -> %d\n", near)
+	}
+	fmt.Printf("in 0/0-20/20 -> %v\n", w.Query(Rect{0, 0, 20, 20}))
+
+	saveDemo(w)
+	loopDemo()
+	pathDemo()
+	replayDemo()
+	physicsDemo()
+	ecsDemo()
+	collectDemo()
+	npcDemo()
+}
+
+// npcDemo has a guard patrol around a wall, until a player comes close and it gives chase, while a critter runs away.
+func npcDemo() {
+	brains, err := LoadBrains(strings.NewReader(DefaultBrains))
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	w, _ := NewWorld(16, 10, Reject)
+	for y := 3; y < 7; y++ {
+		w.AddObstacle(7, y)
+	}
+	guard, _ := w.Add(&Item{2, 2})
+	critter, _ := w.Add(&Item{13, 8})
+	p := Player{Name: "Madalina", Item: Item{14, 0}}
+	id, _ := w.Add(&p)
+
+	npcs := NewNPCs(brains, 1)
+	npcs.Control(guard, "guard")
+	npcs.Control(critter, "critter")
+
+	l, _ := NewLoop(w, 20)
+	l.OnTick(npcs.Update)
+	for i := 0; i < 16; i++ {
+		if i < 8 {
+			w.Move(id, p.X, p.Y+1) // the player walks down, past the critter
+		}
+		l.Step()
+		gs, _ := npcs.State(guard)
+		cs, _ := npcs.State(critter)
+		fmt.Printf("npc: guard %s %v, critter %s %v\n", gs, position(w, guard), cs, position(w, critter))
+	}
+}
+
+// collectDemo has a player walk over a line of coins, with the scores kept in a leaderboard file.
+func collectDemo() {
+	dir, err := os.MkdirTemp("", "game")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	lb, err := LoadLeaderboard(filepath.Join(dir, "leaderboard.json"))
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	w, _ := NewWorld(20, 5, Reject)
+	w.OnCollision(Collect(lb))
+	for x := 4; x < 10; x += 2 {
+		w.Add(NewCollectible(x, 1, "coin", 10))
+	}
+	w.Add(NewCollectible(12, 1, "gem", 50))
+	p := Player{Name: "Karim", Item: Item{0, 0}}
+	id, _ := w.Add(&p)
+
+	for x := 1; x < 14; x++ {
+		w.Move(id, x, 0) // p is 2x2, it covers y=1
+	}
+	fmt.Printf("collect: %s -> score %d, coins %d, gems %d, %d entities left\n",
+		p.Name, p.Score, p.Inventory.Count("coin"), p.Inventory.Count("gem"), w.Len())
+
+	lb.Submit("Madalina", 40)
+	if err := lb.Save(); err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	loaded, err := LoadLeaderboard(filepath.Join(dir, "leaderboard.json"))
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Printf("collect: leaderboard -> %+v\n", loaded.Top(10))
 }
 
+// ecsDemo builds entities out of components instead of embedded structs.
+func ecsDemo() {
+	var r Registry
+	for i, name := range []string{"Karim", "Madalina", "rock"} {
+		e := r.NewEntity()
+		r.Names.Set(e, Name{name})
+		r.Positions.Set(e, Position{float64(i), 0})
+		r.Healths.Set(e, Health{100 - i*50, 100})
+		if name != "rock" {
+			r.Velocities.Set(e, Velocity{1, 2}) // rocks don't move
+		}
+	}
+
+	MovementSystem(&r, 1)
+	r.Healths.Each(func(e EntityID, h *Health) { h.HP -= 25 })
+	fmt.Printf("ecs: dead -> %v\n", ReapSystem(&r))
+
+	Each2(&r.Names, &r.Positions, func(e EntityID, n *Name, p *Position) {
+		fmt.Printf("ecs: %d %s -> %v/%v\n", e, n.Value, p.X, p.Y)
+	})
+}
+
+// physicsDemo bounces a body around a small world.
+func physicsDemo() {
+	w, _ := NewWorld(20, 5, Reject)
+	b := NewBody(1, 1)
+	b.SetVelocity(40, 15)
+	b.Friction = 0.5
+	w.Add(b)
+
+	l, _ := NewLoop(w, 10)
+	l.OnTick(UpdateBehaviours(l.TickRate))
+	for i := 0; i < 10; i++ {
+		l.Step()
+		fmt.Printf("body -> %d/%d (%.1f, %.1f)\n", b.X, b.Y, b.VX, b.VY)
+	}
+
+	// A body is still a Mover.
+	moveAll([]Mover{b, &Item{}}, 3, 3)
+	fmt.Printf("body (moveAll) -> %d/%d\n", b.X, b.Y)
+}
+
+// replayDemo records a few moves, undoes and redoes some, and replays the log on a fresh world.
+func replayDemo() {
+	const seed = 42
+	w, err := NewSeededWorld(seed)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	events := NewEventLog(seed)
+	events.Attach(w)
+
+	rnd := rand.New(rand.NewSource(7))
+	for i := 0; i < 10; i++ {
+		id := ID(rnd.Intn(w.Len()) + 1)
+		w.Move(id, rnd.Intn(maxX), rnd.Intn(maxY)) // blocked moves fail and are not recorded
+	}
+	events.Undo(w)
+	events.Undo(w)
+	events.Redo(w)
+	fmt.Printf("replay: %d moves recorded, %d applied\n", len(events.Events), len(events.Applied()))
+
+	var buf bytes.Buffer
+	events.Save(&buf)
+	loaded, err := LoadEventLog(&buf)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	replayed, err := loaded.Replay(nil)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	var want, got bytes.Buffer
+	SaveWorld(&want, w, JSON)
+	SaveWorld(&got, replayed, JSON)
+	fmt.Printf("replay: same world -> %v\n", bytes.Equal(want.Bytes(), got.Bytes()))
+}
+
+// pathDemo walks a player around a wall, one cell per tick.
+func pathDemo() {
+	w, _ := NewWorld(10, 6, Reject)
+	for y := 0; y < 4; y++ { // leaves a gap of 2 cells, players are 2x2
+		w.AddObstacle(4, y)
+	}
+	p := Player{Name: "Karim", Item: Item{1, 1}}
+	id, _ := w.Add(&p)
+
+	nav := NewNavigator(PathOptions{Heuristic: Octile, Diagonal: true})
+	if err := nav.GoTo(w, id, Point{8, 1}); err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	// No need for Run here, Step drives the loop by hand.
+	l, _ := NewLoop(w, 20)
+	l.OnTick(nav.Update)
+	for nav.Walking(id) {
+		snap := l.Step()
+		fmt.Printf("tick %d -> %d/%d\n", snap.Tick, p.X, p.Y)
+	}
+	fmt.Print(RenderString(w, w.Width, w.Height))
+}
+
+// watch draws a seeded world in the terminal, with its players walking to random places and picking up coins, until
+// interrupted. The best scores are kept in the leaderboard file at scores, NPCs get their brains from the file at npcs
+// or DefaultBrains.
+func watch(scores, npcs string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	w, err := NewSeededWorld(time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	l, err := NewLoop(w, 10)
+	if err != nil {
+		return err
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	nav := NewNavigator(PathOptions{Heuristic: Octile, Diagonal: true})
+	l.OnTick(func(w *World, tick uint64) {
+		w.Each(func(id ID, e Entity) {
+			if _, ok := e.(*Player); ok && !nav.Walking(id) {
+				// Short trips, so A* doesn't have to search the whole world.
+				x, y := e.Position()
+				nav.GoTo(w, id, Point{clamp(x+rnd.Intn(200)-100, 0, w.Width-1), clamp(y+rnd.Intn(200)-100, 0, w.Height-1)})
+			}
+		})
+	})
+	l.OnTick(nav.Update)
+
+	for i := 0; i < 10; i++ {
+		b := NewBody(rnd.Intn(w.Width), rnd.Intn(w.Height))
+		b.SetVelocity(float64(rnd.Intn(400)-200), float64(rnd.Intn(400)-200))
+		if _, err := w.Add(b); err != nil {
+			continue // landed on an obstacle
+		}
+	}
+	l.OnTick(UpdateBehaviours(l.TickRate))
+
+	lb, err := LoadLeaderboard(scores)
+	if err != nil {
+		return err
+	}
+	defer lb.Save()
+	w.OnCollision(Collect(lb))
+	for i := 0; i < 200; i++ {
+		w.Add(NewCollectible(rnd.Intn(w.Width), rnd.Intn(w.Height), "coin", 10)) // fails on obstacles
+	}
+	l.OnTick(func(w *World, tick uint64) {
+		if tick%uint64(5*l.TickRate) == 0 {
+			// In its own goroutine, the loop doesn't wait for the disk.
+			go lb.Save()
+		}
+	})
+
+	var brains map[string]*BrainDef
+	if npcs != "" {
+		brains, err = LoadBrainsFile(npcs)
+	} else {
+		brains, err = LoadBrains(strings.NewReader(DefaultBrains))
+	}
+	if err != nil {
+		return err
+	}
+	ai := NewNPCs(brains, 1)
+	for i := 0; i < 20; i++ {
+		id, err := w.Add(&Item{rnd.Intn(w.Width), rnd.Intn(w.Height)})
+		if err != nil {
+			continue
+		}
+		// Only the critters, the default guards patrol the top left corner of the world.
+		ai.Control(id, "critter")
+	}
+	l.OnTick(ai.Update)
+
+	r := NewRenderer(os.Stdout)
+	watchResize(ctx, r)
+	defer r.Close()
+	l.OnTick(func(w *World, tick uint64) {
+		status := fmt.Sprintf("tick %d - %d entities", tick, w.Len())
+		if top := lb.Top(1); len(top) > 0 {
+			status += fmt.Sprintf(" - best %s %d", top[0].Name, top[0].Score)
+		}
+		r.Draw(w, status+" - ctrl+c to quit")
+	})
+
+	return l.Run(ctx)
+}
+
+// serve runs a world and its loop, with a server letting players join over TCP, until interrupted.
+func serve(addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	w, err := NewWorld(maxX, maxY, Clamp)
+	if err != nil {
+		return err
+	}
+	l, err := NewLoop(w, 20)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving on %s", ln.Addr())
+
+	go l.Run(ctx)
+	s := Server{Loop: l, IdleTimeout: 30 * time.Second}
+	return s.Serve(ctx, ln)
+}
+
+// saveDemo saves w in both formats and loads it back.
+func saveDemo(w *World) {
+	for _, f := range []Format{JSON, Binary} {
+		var buf bytes.Buffer
+		if err := SaveWorld(&buf, w, f); err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		size := buf.Len()
+
+		loaded, err := LoadWorld(&buf)
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		s, _ := loaded.Save()
+		fmt.Printf("save (%s, %d bytes) -> %+v\n", f, size, *s)
+	}
+}
+
+// loopDemo runs the game loop for a few ticks, with a player sending commands from its own goroutine.
+func loopDemo() {
+	w, _ := NewWorld(maxX, maxY, Reject)
+	p := Player{Name: "Madalina", Item: Item{1, 1}}
+	id, _ := w.Add(&p)
+
+	l, _ := NewLoop(w, 20)
+	l.OnError = func(id ID, cmd Command, err error) {
+		fmt.Println("error:", err)
+	}
+
+	cmds := make(chan Command)
+	l.Input(id, cmds)
+	snaps, unsubscribe := l.Subscribe(10)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		defer close(cmds)
+		for i := 1; i <= 3; i++ {
+			select {
+			case cmds <- Command{i * 10, i * 10}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go l.Run(ctx)
+	for snap := range snaps {
+		fmt.Printf("tick %d -> %+v\n", snap.Tick, snap.Entities)
+	}
+}
+
+// moveAll moves every m without any bounds check, use World.MoveAll to keep entities inside the world.
 func moveAll(ms []Mover, x, y int) {
 	for _, m := range ms {
 		m.Move(x, y)
@@ -54,7 +483,7 @@ func (i *Item) Move(x, y int) {
 }
 
 func NewItem(x, y int) (*Item, error) {
-	if x > maxX || y > maxY {
+	if x < 0 || x >= maxX || y < 0 || y >= maxY {
 		return nil, fmt.Errorf("%d/%d out of bonds %d/%d", x, y, maxX, maxY)
 	}
 
@@ -64,6 +493,7 @@ func NewItem(x, y int) (*Item, error) {
 	return &i, nil
 }
 
+// maxX/maxY is the size of the default world, a World can have any size (see NewWorld).
 const (
 	maxX = 1000
 	maxY = 600
@@ -81,6 +511,9 @@ type Player struct {
 	// An issue tho, is that if the struct has a conflicting key, the go compiler will not notify you of that and
 	// this can create bugs.
 	// Item Item -> you could also do this way, but you'd lose the features above mentioned.
+
+	Score     int       // points of the collectibles picked up, see Collect
+	Inventory Inventory // collectibles picked up, by kind
 }
 
 type Item struct {
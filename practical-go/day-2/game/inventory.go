@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Collectible is an entity players pick up by walking onto it, see Collect.
+type Collectible struct {
+	Item
+	Kind   string // e.g. "coin", what it's counted as in an Inventory
+	Points int
+}
+
+func NewCollectible(x, y int, kind string, points int) *Collectible {
+	return &Collectible{Item: Item{x, y}, Kind: kind, Points: points}
+}
+
+// Inventory counts the collectibles a player holds, by kind. A nil Inventory is empty, Add allocates it.
+type Inventory map[string]int
+
+// Add puts n collectibles of kind in the inventory.
+func (inv *Inventory) Add(kind string, n int) {
+	if *inv == nil {
+		*inv = Inventory{}
+	}
+	(*inv)[kind] += n
+}
+
+// Count returns how many collectibles of kind are in the inventory.
+func (inv Inventory) Count(kind string) int {
+	return inv[kind]
+}
+
+// Kinds returns the kinds in the inventory, sorted.
+func (inv Inventory) Kinds() []string {
+	kinds := make([]string, 0, len(inv))
+	for k := range inv {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Clone returns a copy of inv. A map is a reference, copying a Player shares its inventory with the copy.
+func (inv Inventory) Clone() Inventory {
+	if inv == nil {
+		return nil
+	}
+	c := make(Inventory, len(inv))
+	for k, n := range inv {
+		c[k] = n
+	}
+	return c
+}
+
+// Collect returns a collision callback making players pick up the collectibles they touch: the collectible is removed
+// from the world, goes in the player's inventory and its points are added to the player's score. It doesn't matter
+// which of the two moved. If lb isn't nil, the new score of the player is submitted to it.
+func Collect(lb *Leaderboard) CollisionFunc {
+	return func(w *World, mover, other ID) {
+		a, _ := w.Entity(mover)
+		b, _ := w.Entity(other)
+		p, pok := a.(*Player)
+		c, cok := b.(*Collectible)
+		cid := other
+		if !pok || !cok {
+			p, pok = b.(*Player)
+			c, cok = a.(*Collectible)
+			cid = mover
+		}
+		if !pok || !cok {
+			return
+		}
+
+		w.Remove(cid)
+		p.Inventory.Add(c.Kind, 1)
+		p.Score += c.Points
+		if lb != nil {
+			lb.Submit(p.Name, p.Score)
+		}
+	}
+}
+
+// HighScore is an entry of a Leaderboard.
+type HighScore struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+// Leaderboard keeps the best score of every player, across runs, in a JSON file.
+//
+// Submit is called from the game loop and only touches memory, under a mutex, so it's cheap and safe to call while
+// other goroutines read the board (e.g. a server showing it). Writing the file is left to Save, called when it suits
+// the game: at the end of a round, every few seconds...
+type Leaderboard struct {
+	path string
+
+	mu     sync.Mutex
+	best   map[string]int
+	dirty  bool       // changed since the last Save
+	saveMu sync.Mutex // one Save at a time, so an older board never overwrites a newer one
+}
+
+// LoadLeaderboard reads the leaderboard saved at path. A missing file is an empty leaderboard, created on the first
+// Save.
+func LoadLeaderboard(path string) (*Leaderboard, error) {
+	lb := Leaderboard{path: path, best: map[string]int{}}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &lb, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var scores []HighScore
+	if err := json.NewDecoder(file).Decode(&scores); err != nil {
+		return nil, fmt.Errorf("load leaderboard %s: %w", path, err)
+	}
+	for _, s := range scores {
+		if best, ok := lb.best[s.Name]; !ok || s.Score > best {
+			lb.best[s.Name] = s.Score
+		}
+	}
+	return &lb, nil
+}
+
+// Submit records score for name, it only replaces the best score of name when it's higher. It reports whether it did.
+func (lb *Leaderboard) Submit(name string, score int) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if best, ok := lb.best[name]; ok && score <= best {
+		return false
+	}
+	lb.best[name] = score
+	lb.dirty = true
+	return true
+}
+
+// Best returns the best score of name.
+func (lb *Leaderboard) Best(name string) (int, bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	score, ok := lb.best[name]
+	return score, ok
+}
+
+// Top returns the n best scores, highest first, ties by name. n <= 0 returns them all.
+func (lb *Leaderboard) Top(n int) []HighScore {
+	lb.mu.Lock()
+	scores := make([]HighScore, 0, len(lb.best))
+	for name, score := range lb.best {
+		scores = append(scores, HighScore{name, score})
+	}
+	lb.mu.Unlock()
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Name < scores[j].Name
+	})
+	if n > 0 && n < len(scores) {
+		scores = scores[:n]
+	}
+	return scores
+}
+
+// Save writes the leaderboard to its file, if it changed since the last Save. Like SaveFile, it writes to a temporary
+// file and renames it, so the file is always either the old or the new board.
+// The board is copied under the mutex and written without it, Submit never waits for the disk.
+func (lb *Leaderboard) Save() error {
+	lb.saveMu.Lock()
+	defer lb.saveMu.Unlock()
+
+	lb.mu.Lock()
+	dirty := lb.dirty
+	lb.dirty = false
+	lb.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+
+	if err := lb.write(lb.Top(0)); err != nil {
+		lb.mu.Lock()
+		lb.dirty = true // try again on the next Save
+		lb.mu.Unlock()
+		return fmt.Errorf("save leaderboard %s: %w", lb.path, err)
+	}
+	return nil
+}
+
+func (lb *Leaderboard) write(scores []HighScore) error {
+	tmp, err := os.CreateTemp(filepath.Dir(lb.path), filepath.Base(lb.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(scores); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), lb.path)
+}
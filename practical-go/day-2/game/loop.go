@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Command is a request from a player to move its entity to X/Y.
+type Command struct {
+	X, Y int
+}
+
+// Snapshot is the state of the world at the end of a tick.
+// Snapshots are shared between observers, they must not be modified.
+type Snapshot struct {
+	Tick     uint64
+	Entities []EntityState
+}
+
+// EntityState is what a Snapshot knows about an entity.
+type EntityState struct {
+	ID    ID
+	Kind  string
+	Name  string `json:",omitempty"` // of a player, or the kind of a collectible
+	X, Y  int
+	Score int `json:",omitempty"` // players only
+}
+
+// Loop runs the simulation at a fixed rate. Every tick it takes the commands sent by the players, applies them to the
+// world and publishes a Snapshot to the observers.
+//
+// Commands are applied deterministically: players in increasing ID order, and the commands of each player in the
+// order they were sent. Once Run is called, the world belongs to the loop goroutine and must not be touched from
+// anywhere else.
+type Loop struct {
+	World    *World
+	TickRate int   // ticks per second
+	Clock    Clock // RealClock if nil
+
+	// OnError, if not nil, is called from the loop goroutine when a command can't be applied.
+	OnError func(id ID, cmd Command, err error)
+
+	mu        sync.Mutex
+	tick      uint64
+	inputs    map[ID]<-chan Command
+	observers map[chan Snapshot]struct{}
+	calls     []func(w *World)
+	onTick    []func(w *World, tick uint64)
+}
+
+func NewLoop(w *World, tickRate int) (*Loop, error) {
+	if err := checkTickRate(tickRate); err != nil {
+		return nil, err
+	}
+
+	l := Loop{
+		World:     w,
+		TickRate:  tickRate,
+		inputs:    make(map[ID]<-chan Command),
+		observers: make(map[chan Snapshot]struct{}),
+	}
+	return &l, nil
+}
+
+// Input registers ch as the command channel of the entity id, replacing any previous one.
+// Closing ch, or calling Input with a nil ch, unregisters it.
+func (l *Loop) Input(id ID, ch <-chan Command) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ch == nil {
+		delete(l.inputs, id)
+		return
+	}
+	l.inputs[id] = ch
+}
+
+// Subscribe returns a channel receiving a Snapshot after every tick, and a function to stop receiving them.
+// The channel has room for buf snapshots. When an observer falls behind, new snapshots are dropped instead of slowing
+// down the loop - use Snapshot.Tick to notice the gaps. The channel is closed on unsubscribe or when Run returns.
+func (l *Loop) Subscribe(buf int) (<-chan Snapshot, func()) {
+	ch := make(chan Snapshot, buf)
+
+	l.mu.Lock()
+	l.observers[ch] = struct{}{}
+	l.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			if _, ok := l.observers[ch]; ok {
+				delete(l.observers, ch)
+				close(ch)
+			}
+		})
+	}
+	return ch, cancel
+}
+
+// Do queues fn to run on the loop goroutine at the start of the next tick, before the commands are applied. It's the
+// only safe way to change the world, e.g. to add or remove players, while Run is running.
+func (l *Loop) Do(fn func(w *World)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls = append(l.calls, fn)
+}
+
+// OnTick registers fn to run on the loop goroutine every tick, after the commands are applied and before the snapshot
+// is taken. This is where anything that moves on its own, like a Navigator, gets updated. They run in the order they
+// were registered.
+func (l *Loop) OnTick(fn func(w *World, tick uint64)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.onTick = append(l.onTick, fn)
+}
+
+// Tick returns the number of ticks run so far.
+func (l *Loop) Tick() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.tick
+}
+
+// Run ticks until ctx is cancelled. It stops the ticker, closes every observer channel and returns ctx.Err().
+func (l *Loop) Run(ctx context.Context) error {
+	if err := checkTickRate(l.TickRate); err != nil {
+		return err
+	}
+	clock := l.Clock
+	if clock == nil {
+		clock = RealClock{}
+	}
+
+	ticker := clock.NewTicker(time.Second / time.Duration(l.TickRate))
+	defer ticker.Stop()
+	defer l.closeObservers()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+			l.Step()
+		}
+	}
+}
+
+// checkTickRate checks the interval between ticks is at least a nanosecond, tickers panic on a 0 interval.
+func checkTickRate(tickRate int) error {
+	if tickRate <= 0 || time.Duration(tickRate) > time.Second {
+		return fmt.Errorf("bad tick rate %d, must be between 1 and %d", tickRate, time.Second)
+	}
+	return nil
+}
+
+// Step runs a single tick right away. Run calls it on every tick, but it can also be called directly to drive the
+// loop by hand, as long as Run is not running.
+func (l *Loop) Step() Snapshot {
+	l.mu.Lock()
+	l.tick++
+	tick := l.tick
+	ids := make([]ID, 0, len(l.inputs))
+	for id := range l.inputs {
+		ids = append(ids, id)
+	}
+	inputs := make([]<-chan Command, len(ids))
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		inputs[i] = l.inputs[id]
+	}
+	calls := l.calls
+	l.calls = nil
+	onTick := l.onTick
+	l.mu.Unlock()
+
+	for _, fn := range calls {
+		fn(l.World)
+	}
+
+	for i, id := range ids {
+		for _, cmd := range l.drain(id, inputs[i]) {
+			l.apply(id, cmd)
+		}
+	}
+
+	for _, fn := range onTick {
+		fn(l.World, tick)
+	}
+
+	snap := l.snapshot(tick)
+	l.publish(snap)
+	return snap
+}
+
+// drain returns the commands waiting on ch without blocking. A closed ch is unregistered.
+func (l *Loop) drain(id ID, ch <-chan Command) []Command {
+	var cmds []Command
+	for {
+		select {
+		case cmd, ok := <-ch:
+			if !ok {
+				l.mu.Lock()
+				if l.inputs[id] == ch {
+					delete(l.inputs, id)
+				}
+				l.mu.Unlock()
+				return cmds
+			}
+			cmds = append(cmds, cmd)
+		default:
+			return cmds
+		}
+	}
+}
+
+func (l *Loop) apply(id ID, cmd Command) {
+	if err := l.World.Move(id, cmd.X, cmd.Y); err != nil && l.OnError != nil {
+		l.OnError(id, cmd, err)
+	}
+}
+
+func (l *Loop) snapshot(tick uint64) Snapshot {
+	snap := Snapshot{
+		Tick:     tick,
+		Entities: make([]EntityState, 0, l.World.Len()),
+	}
+	l.World.Each(func(id ID, e Entity) {
+		snap.Entities = append(snap.Entities, entityState(id, e))
+	})
+	return snap
+}
+
+func entityState(id ID, e Entity) EntityState {
+	s := EntityState{ID: id}
+	s.X, s.Y = e.Position()
+
+	switch e := e.(type) {
+	case *Player:
+		s.Kind = "player"
+		s.Name = e.Name
+		s.Score = e.Score
+	case *Body:
+		s.Kind = "body"
+	case *Collectible:
+		s.Kind = "collectible"
+		s.Name = e.Kind
+	case *Item:
+		s.Kind = "item"
+	default:
+		s.Kind = fmt.Sprintf("%T", e)
+	}
+	return s
+}
+
+func (l *Loop) publish(snap Snapshot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.observers {
+		select {
+		case ch <- snap:
+		default: // slow observer, drop it
+		}
+	}
+}
+
+func (l *Loop) closeObservers() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.observers {
+		delete(l.observers, ch)
+		close(ch)
+	}
+}
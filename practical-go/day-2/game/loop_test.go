@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLoopFakeClock drives Run with a FakeClock: a tick happens exactly when the clock is advanced by an interval,
+// and never otherwise.
+func TestLoopFakeClock(t *testing.T) {
+	w, err := NewWorld(10, 10, Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Player{Name: "Madalina", Item: Item{1, 1}}
+	id, err := w.Add(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLoop(w, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(time.Unix(0, 0))
+	l.Clock = clock
+	cmds := make(chan Command, 1)
+	l.Input(id, cmds)
+	snaps, _ := l.Subscribe(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Run(ctx) }()
+	waitTicker(t, clock)
+
+	clock.Advance(50 * time.Millisecond) // half an interval
+	select {
+	case snap := <-snaps:
+		t.Fatalf("tick %d before the interval elapsed", snap.Tick)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cmds <- Command{2, 3}
+	clock.Advance(50 * time.Millisecond)
+	snap := receive(t, snaps)
+	if snap.Tick != 1 {
+		t.Fatalf("tick %d, want 1", snap.Tick)
+	}
+	if len(snap.Entities) != 1 || snap.Entities[0].X != 2 || snap.Entities[0].Y != 3 {
+		t.Fatalf("entities %+v, want the player at 2/3", snap.Entities)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	if snap := receive(t, snaps); snap.Tick != 2 {
+		t.Fatalf("tick %d, want 2", snap.Tick)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Run returned %v, want %v", err, context.Canceled)
+	}
+	if _, ok := <-snaps; ok {
+		t.Fatal("observer channel not closed by Run")
+	}
+}
+
+func TestLoopTickRate(t *testing.T) {
+	w, _ := NewWorld(10, 10, Reject)
+	for _, rate := range []int{0, -1, int(time.Second) + 1} {
+		if _, err := NewLoop(w, rate); err == nil {
+			t.Errorf("NewLoop accepted tick rate %d", rate)
+		}
+	}
+
+	l, _ := NewLoop(w, 10)
+	l.TickRate = 2e9
+	l.Clock = NewFakeClock(time.Unix(0, 0))
+	if err := l.Run(context.Background()); err == nil {
+		t.Error("Run accepted tick rate 2e9")
+	}
+}
+
+// waitTicker waits for Run to create its ticker: it only sees the Advance calls made after that.
+func waitTicker(t *testing.T, c *FakeClock) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		n := len(c.tickers)
+		c.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Run didn't create a ticker")
+}
+
+func receive(t *testing.T, snaps <-chan Snapshot) Snapshot {
+	t.Helper()
+	select {
+	case snap := <-snaps:
+		return snap
+	case <-time.After(time.Second):
+		t.Fatal("no snapshot")
+		return Snapshot{}
+	}
+}
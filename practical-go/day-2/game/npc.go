@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// NPCs are entities moved by a state machine instead of a player. Each state has an action, run every tick (or every
+// few ticks), and transitions to other states. The state machines, called brains, are plain JSON so they can be tuned
+// without recompiling:
+//
+//	[{
+//	  "name": "guard",
+//	  "initial": "patrol",
+//	  "states": {
+//	    "patrol": {"action": "patrol", "route": [{"X": 2, "Y": 2}, {"X": 12, "Y": 2}],
+//	               "transitions": [{"when": "player_near", "range": 6, "to": "chase"}]},
+//	    "chase":  {"action": "chase", "every": 2,
+//	               "transitions": [{"when": "player_far", "range": 10, "to": "patrol"}]}
+//	  }
+//	}]
+//
+// Actions:
+//
+//	idle    stay put
+//	wander  step to a random free neighbour cell
+//	patrol  walk the route, around obstacles, and start over
+//	chase   step towards the nearest player
+//	flee    step away from the nearest player
+//
+// Conditions of the transitions:
+//
+//	player_near  a player is within range cells
+//	player_far   no player is within range cells
+//	after        the NPC has been in the state for ticks ticks
+//
+// Transitions are checked in order before the action runs, the first one that holds wins.
+
+// BrainDef is a state machine driving NPCs.
+type BrainDef struct {
+	Name    string              `json:"name"`
+	Initial string              `json:"initial"`
+	States  map[string]StateDef `json:"states"`
+}
+
+type StateDef struct {
+	Action      string       `json:"action"`
+	Every       int          `json:"every,omitempty"` // run the action once every Every ticks, every tick if 0
+	Route       []Point      `json:"route,omitempty"` // for patrol
+	Transitions []Transition `json:"transitions,omitempty"`
+}
+
+type Transition struct {
+	When  string `json:"when"`
+	Range int    `json:"range,omitempty"` // for player_near and player_far
+	Ticks uint64 `json:"ticks,omitempty"` // for after
+	To    string `json:"to"`
+}
+
+// action moves the NPC id, controlled by a, for one tick.
+type action func(n *NPCs, w *World, id ID, a *agent)
+
+var actions = map[string]action{
+	"idle":   func(n *NPCs, w *World, id ID, a *agent) {},
+	"wander": (*NPCs).wander,
+	"patrol": (*NPCs).patrol,
+	"chase":  func(n *NPCs, w *World, id ID, a *agent) { n.follow(w, id, false) },
+	"flee":   func(n *NPCs, w *World, id ID, a *agent) { n.follow(w, id, true) },
+}
+
+var conditions = map[string]bool{"player_near": true, "player_far": true, "after": true}
+
+// DefaultBrains are used when no brain file is given.
+const DefaultBrains = `[
+  {
+    "name": "guard",
+    "initial": "patrol",
+    "states": {
+      "patrol": {"action": "patrol", "route": [{"X": 2, "Y": 2}, {"X": 12, "Y": 2}, {"X": 12, "Y": 8}],
+                 "transitions": [{"when": "player_near", "range": 6, "to": "chase"}]},
+      "chase":  {"action": "chase", "every": 2,
+                 "transitions": [{"when": "player_far", "range": 10, "to": "patrol"}]}
+    }
+  },
+  {
+    "name": "critter",
+    "initial": "wander",
+    "states": {
+      "wander": {"action": "wander", "every": 3,
+                 "transitions": [{"when": "player_near", "range": 4, "to": "flee"}]},
+      "flee":   {"action": "flee",
+                 "transitions": [{"when": "after", "ticks": 10, "to": "wander"}]}
+    }
+  }
+]`
+
+// LoadBrains reads a JSON array of brains and checks them, so a typo in a state name fails at load time instead of
+// leaving an NPC stuck in the middle of a game.
+func LoadBrains(r io.Reader) (map[string]*BrainDef, error) {
+	var defs []*BrainDef
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields() // a misspelled field is a typo too
+	if err := dec.Decode(&defs); err != nil {
+		return nil, fmt.Errorf("load brains: %w", err)
+	}
+
+	brains := make(map[string]*BrainDef, len(defs))
+	for i, b := range defs {
+		if b == nil {
+			return nil, fmt.Errorf("load brains: brain %d is null", i)
+		}
+		if err := b.check(); err != nil {
+			return nil, fmt.Errorf("load brains: %w", err)
+		}
+		if _, ok := brains[b.Name]; ok {
+			return nil, fmt.Errorf("load brains: brain %q defined twice", b.Name)
+		}
+		brains[b.Name] = b
+	}
+	return brains, nil
+}
+
+func LoadBrainsFile(path string) (map[string]*BrainDef, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadBrains(file)
+}
+
+func (b *BrainDef) check() error {
+	if b.Name == "" {
+		return fmt.Errorf("brain without a name")
+	}
+	if _, ok := b.States[b.Initial]; !ok {
+		return fmt.Errorf("brain %q: initial state %q doesn't exist", b.Name, b.Initial)
+	}
+
+	for name, s := range b.States {
+		if _, ok := actions[s.Action]; !ok {
+			return fmt.Errorf("brain %q, state %q: unknown action %q", b.Name, name, s.Action)
+		}
+		if s.Action == "patrol" && len(s.Route) == 0 {
+			return fmt.Errorf("brain %q, state %q: patrol without a route", b.Name, name)
+		}
+		if s.Every < 0 {
+			return fmt.Errorf("brain %q, state %q: every is %d", b.Name, name, s.Every)
+		}
+		for _, t := range s.Transitions {
+			if !conditions[t.When] {
+				return fmt.Errorf("brain %q, state %q: unknown condition %q", b.Name, name, t.When)
+			}
+			if _, ok := b.States[t.To]; !ok {
+				return fmt.Errorf("brain %q, state %q: transition to unknown state %q", b.Name, name, t.To)
+			}
+		}
+	}
+	return nil
+}
+
+// NPCs runs the brains of the entities it controls. Register its Update with Loop.OnTick, like a Navigator.
+// Any entity can be an NPC, the moves go through World.Move and so through the Move method of the entity.
+// Its methods must be called from the loop goroutine (e.g. through Loop.Do).
+type NPCs struct {
+	Brains map[string]*BrainDef
+	Path   PathOptions // used to patrol around obstacles
+
+	rnd    *rand.Rand
+	agents map[ID]*agent
+}
+
+// agent is the state of one NPC.
+type agent struct {
+	brain    *BrainDef
+	state    string
+	entered  uint64 // tick the state was entered on
+	started  bool   // false until the first Update, which sets entered
+	waypoint int    // index in the patrol route
+	path     []Point
+}
+
+// NewNPCs returns NPCs running brains. NPCs with the same seed, driving the same world, make the same moves.
+func NewNPCs(brains map[string]*BrainDef, seed int64) *NPCs {
+	return &NPCs{
+		Brains: brains,
+		Path:   PathOptions{Heuristic: Octile, Diagonal: true},
+		rnd:    rand.New(rand.NewSource(seed)),
+		agents: make(map[ID]*agent),
+	}
+}
+
+// Control gives the entity id the brain named brain, starting in its initial state on the next Update.
+func (n *NPCs) Control(id ID, brain string) error {
+	b, ok := n.Brains[brain]
+	if !ok {
+		return fmt.Errorf("npc %d: unknown brain %q", id, brain)
+	}
+	n.agents[id] = &agent{brain: b, state: b.Initial}
+	return nil
+}
+
+// Release stops controlling id, the entity stays where it is.
+func (n *NPCs) Release(id ID) {
+	delete(n.agents, id)
+}
+
+// State returns the name of the state id is in.
+func (n *NPCs) State(id ID) (string, bool) {
+	a, ok := n.agents[id]
+	if !ok {
+		return "", false
+	}
+	return a.state, true
+}
+
+// Update runs one tick of every NPC, in id order so the same world and seed always give the same game. NPCs whose
+// entity was removed from the world are released.
+func (n *NPCs) Update(w *World, tick uint64) {
+	ids := make([]ID, 0, len(n.agents))
+	for id := range n.agents {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+
+	for _, id := range ids {
+		if _, ok := w.Entity(id); !ok {
+			n.Release(id)
+			continue
+		}
+		a := n.agents[id]
+		if !a.started {
+			a.entered, a.started = tick, true
+		}
+
+		for _, t := range a.brain.States[a.state].Transitions {
+			if n.holds(w, id, a, t, tick) {
+				a.state, a.entered, a.path = t.To, tick, nil
+				break
+			}
+		}
+
+		s := a.brain.States[a.state]
+		if s.Every > 1 && (tick-a.entered)%uint64(s.Every) != 0 {
+			continue
+		}
+		actions[s.Action](n, w, id, a)
+	}
+}
+
+func (n *NPCs) holds(w *World, id ID, a *agent, t Transition, tick uint64) bool {
+	switch t.When {
+	case "player_near", "player_far":
+		_, dist, ok := nearestPlayer(w, id)
+		near := ok && dist <= t.Range*t.Range
+		return near == (t.When == "player_near")
+	case "after":
+		return tick-a.entered >= t.Ticks
+	}
+	return false
+}
+
+// wander and follow step in any of the 8 directions, with the moves the pathfinder allows: a diagonal step can't cut
+// the corner of an obstacle.
+func (n *NPCs) wander(w *World, id ID, a *agent) {
+	var free []Point
+	w.neighbours(bounds(w, id), true, func(p Point, _ float64) {
+		free = append(free, p)
+	})
+	if len(free) > 0 {
+		p := free[n.rnd.Intn(len(free))]
+		w.Move(id, p.X, p.Y)
+	}
+}
+
+// patrol walks a along its route one cell per run. The path to the next waypoint is computed once and kept, and
+// computed again when the NPC got pushed off it or it got blocked.
+func (n *NPCs) patrol(w *World, id ID, a *agent) {
+	route := a.brain.States[a.state].Route
+	e, _ := w.Entity(id)
+	pos := position(w, id)
+
+	if pos == route[a.waypoint%len(route)] {
+		a.waypoint = (a.waypoint + 1) % len(route)
+		a.path = nil
+	}
+	if len(a.path) == 0 || w.fits(boxAt(e, a.path[0].X, a.path[0].Y)) != nil || !adjacent(pos, a.path[0]) {
+		path, err := w.PathTo(id, route[a.waypoint%len(route)], n.Path)
+		if err != nil {
+			a.waypoint = (a.waypoint + 1) % len(route) // unreachable, try the next one next time
+			a.path = nil
+			return
+		}
+		a.path = path
+	}
+	if len(a.path) == 0 {
+		return
+	}
+
+	if err := w.Move(id, a.path[0].X, a.path[0].Y); err == nil {
+		a.path = a.path[1:]
+	}
+}
+
+// follow steps id one cell towards the nearest player, or away from it. It's greedy, which is what a chase needs:
+// players move every tick, a path would be stale by the next one.
+func (n *NPCs) follow(w *World, id ID, away bool) {
+	target, _, ok := nearestPlayer(w, id)
+	if !ok {
+		return
+	}
+
+	pos := position(w, id)
+	best, bestDist := pos, distSqPoints(pos, target)
+	w.neighbours(bounds(w, id), true, func(p Point, _ float64) {
+		dist := distSqPoints(p, target)
+		if (!away && dist < bestDist) || (away && dist > bestDist) {
+			best, bestDist = p, dist
+		}
+	})
+	if best != pos {
+		w.Move(id, best.X, best.Y)
+	}
+}
+
+// nearestPlayer returns the position of the player closest to id, and the square of its distance.
+func nearestPlayer(w *World, id ID) (Point, int, bool) {
+	pos := position(w, id)
+	pid, ok := w.Nearest(pos.X, pos.Y, func(other ID, e Entity) bool {
+		_, isPlayer := e.(*Player)
+		return isPlayer && other != id
+	})
+	if !ok {
+		return Point{}, 0, false
+	}
+
+	p := position(w, pid)
+	return p, distSqPoints(pos, p), true
+}
+
+func position(w *World, id ID) Point {
+	e, _ := w.Entity(id)
+	x, y := e.Position()
+	return Point{x, y}
+}
+
+func bounds(w *World, id ID) Rect {
+	e, _ := w.Entity(id)
+	return e.Bounds()
+}
+
+func adjacent(a, b Point) bool {
+	return absInt(a.X-b.X) <= 1 && absInt(a.Y-b.Y) <= 1
+}
+
+func distSqPoints(a, b Point) int {
+	dx, dy := a.X-b.X, a.Y-b.Y
+	return dx*dx + dy*dy
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrNoPath = errors.New("no path")
+
+// Heuristic estimates the cost of going from a to b. A* finds the shortest path as long as it never overestimates,
+// and the closer the estimate the fewer cells it has to look at.
+type Heuristic func(a, b Point) float64
+
+// Manhattan is the exact cost on an empty grid when moving only up, down, left and right.
+func Manhattan(a, b Point) float64 {
+	return float64(absInt(a.X-b.X) + absInt(a.Y-b.Y))
+}
+
+// Euclidean is the straight line distance. It never overestimates, but it underestimates grid moves a lot, so A*
+// explores more than with the other two.
+func Euclidean(a, b Point) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+}
+
+// Octile is the exact cost on an empty grid when diagonal moves are allowed and cost √2.
+func Octile(a, b Point) float64 {
+	dx, dy := float64(absInt(a.X-b.X)), float64(absInt(a.Y-b.Y))
+	return math.Max(dx, dy) + (math.Sqrt2-1)*math.Min(dx, dy)
+}
+
+// PathOptions configures FindPath. The zero value moves up, down, left and right, with the Manhattan heuristic.
+type PathOptions struct {
+	Heuristic Heuristic // Manhattan if nil
+	Diagonal  bool      // allow diagonal moves, they cost √2 and can't cut the corner of an obstacle
+}
+
+var (
+	straight = []Point{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+	diagonal = []Point{{1, -1}, {1, 1}, {-1, 1}, {-1, -1}}
+)
+
+// FindPath returns the shortest path from from to to, avoiding obstacles, using A*. The path doesn't include from
+// and ends with to. Paths stay inside the world, they never wrap around even when the Policy is Wrap.
+func (w *World) FindPath(from, to Point, opts PathOptions) ([]Point, error) {
+	return w.findPath(Rect{from.X, from.Y, 1, 1}, to, opts)
+}
+
+// findPath is FindPath for an entity of the size of box, standing on box: every cell the entity covers along the
+// way must be free, not only the one of its position.
+func (w *World) findPath(box Rect, to Point, opts PathOptions) ([]Point, error) {
+	from := Point{box.X, box.Y}
+	if !w.Contains(from.X, from.Y) || !w.Contains(to.X, to.Y) {
+		return nil, fmt.Errorf("path %v to %v: %w", from, to, ErrOutOfBounds)
+	}
+	if err := w.fits(Rect{to.X, to.Y, box.W, box.H}); err != nil {
+		return nil, fmt.Errorf("path %v to %v: %w", from, to, err)
+	}
+
+	h := opts.Heuristic
+	if h == nil {
+		h = Manhattan
+	}
+
+	cost := map[Point]float64{from: 0} // best known cost from the start
+	came := make(map[Point]Point)      // where the best path to a point comes from
+	closed := make(map[Point]bool)
+
+	open := &pathQueue{}
+	heap.Push(open, &pathNode{p: from, f: h(from, to)})
+
+	for open.Len() > 0 {
+		cur := heap.Pop(open).(*pathNode).p
+		if cur == to {
+			return buildPath(came, from, to), nil
+		}
+		if closed[cur] {
+			continue // stale entry, a cheaper one was already expanded
+		}
+		closed[cur] = true
+
+		w.neighbours(Rect{cur.X, cur.Y, box.W, box.H}, opts.Diagonal, func(next Point, step float64) {
+			c := cost[cur] + step
+			if old, ok := cost[next]; ok && c >= old {
+				return
+			}
+			cost[next] = c
+			came[next] = cur
+			heap.Push(open, &pathNode{p: next, f: c + h(next, to), h: h(next, to), seq: open.seq})
+			open.seq++
+		})
+	}
+
+	return nil, fmt.Errorf("path %v to %v: %w", from, to, ErrNoPath)
+}
+
+// PathTo returns the path for the entity id from where it is to to.
+func (w *World) PathTo(id ID, to Point, opts PathOptions) ([]Point, error) {
+	e, ok := w.entities[id]
+	if !ok {
+		return nil, fmt.Errorf("path: unknown entity %d", id)
+	}
+
+	return w.findPath(e.Bounds(), to, opts)
+}
+
+// neighbours calls fn with every position reachable in one step by an entity on box, and the cost of the step. The
+// whole box must fit on the new position, see World.fits.
+func (w *World) neighbours(box Rect, diag bool, fn func(next Point, cost float64)) {
+	p := Point{box.X, box.Y}
+	free := func(x, y int) bool {
+		return w.fits(Rect{x, y, box.W, box.H}) == nil
+	}
+
+	for _, d := range straight {
+		if free(p.X+d.X, p.Y+d.Y) {
+			fn(Point{p.X + d.X, p.Y + d.Y}, 1)
+		}
+	}
+	if !diag {
+		return
+	}
+	for _, d := range diagonal {
+		// Both cells next to the corner must be free, otherwise the diagonal squeezes through a wall.
+		if free(p.X+d.X, p.Y+d.Y) && free(p.X+d.X, p.Y) && free(p.X, p.Y+d.Y) {
+			fn(Point{p.X + d.X, p.Y + d.Y}, math.Sqrt2)
+		}
+	}
+}
+
+func buildPath(came map[Point]Point, from, to Point) []Point {
+	var path []Point
+	for p := to; p != from; p = came[p] {
+		path = append(path, p)
+	}
+
+	// We walked from the end to the start.
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+type pathNode struct {
+	p   Point
+	f   float64 // cost so far + heuristic
+	h   float64
+	seq int
+}
+
+// pathQueue is a min-heap of nodes by f. Ties go to the node closer to the goal, then to the oldest one, so the same
+// search always returns the same path.
+type pathQueue struct {
+	nodes []*pathNode
+	seq   int
+}
+
+func (q *pathQueue) Len() int {
+	return len(q.nodes)
+}
+
+func (q *pathQueue) Less(i, j int) bool {
+	a, b := q.nodes[i], q.nodes[j]
+	if a.f != b.f {
+		return a.f < b.f
+	}
+	if a.h != b.h {
+		return a.h < b.h
+	}
+	return a.seq < b.seq
+}
+
+func (q *pathQueue) Swap(i, j int) {
+	q.nodes[i], q.nodes[j] = q.nodes[j], q.nodes[i]
+}
+
+func (q *pathQueue) Push(x any) {
+	q.nodes = append(q.nodes, x.(*pathNode))
+}
+
+func (q *pathQueue) Pop() any {
+	n := q.nodes[len(q.nodes)-1]
+	q.nodes[len(q.nodes)-1] = nil
+	q.nodes = q.nodes[:len(q.nodes)-1]
+	return n
+}
+
+// Navigator walks entities along their paths, one cell per tick. Register its Update with Loop.OnTick.
+// Its methods must be called from the loop goroutine (e.g. through Loop.Do).
+type Navigator struct {
+	Options PathOptions
+
+	paths map[ID][]Point
+	last  map[ID]Point // where each entity should be, to notice when something else moved it
+}
+
+func NewNavigator(opts PathOptions) *Navigator {
+	n := Navigator{
+		Options: opts,
+		paths:   make(map[ID][]Point),
+		last:    make(map[ID]Point),
+	}
+	return &n
+}
+
+// GoTo computes a path for id to to. The entity starts walking on the next Update. An entity already on to doesn't
+// walk, Walking reports false for it.
+func (n *Navigator) GoTo(w *World, id ID, to Point) error {
+	path, err := w.PathTo(id, to, n.Options)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		n.Stop(id) // already there
+		return nil
+	}
+
+	e, _ := w.Entity(id)
+	x, y := e.Position()
+	n.paths[id] = path
+	n.last[id] = Point{x, y}
+	return nil
+}
+
+// Stop drops the path of id, the entity stays where it is.
+func (n *Navigator) Stop(id ID) {
+	delete(n.paths, id)
+	delete(n.last, id)
+}
+
+// Walking reports whether id still has some path to walk.
+func (n *Navigator) Walking(id ID) bool {
+	_, ok := n.paths[id]
+	return ok
+}
+
+// Update moves every walking entity one cell along its path. The moves go through World.Move, which calls the Move
+// method of the entity - anything implementing Mover can walk a path. When an entity was moved by something else, or
+// its next cell got blocked, its path is computed again. Entities that can't reach their goal anymore stop.
+func (n *Navigator) Update(w *World, tick uint64) {
+	// Walk in id order, so collisions between walkers happen in the same order every run.
+	ids := make([]ID, 0, len(n.paths))
+	for id := range n.paths {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+
+	for _, id := range ids {
+		e, ok := w.Entity(id)
+		if !ok {
+			n.Stop(id)
+			continue
+		}
+
+		path := n.paths[id]
+		if len(path) == 0 {
+			n.Stop(id) // already there
+			continue
+		}
+		x, y := e.Position()
+		if (Point{x, y}) != n.last[id] || w.fits(boxAt(e, path[0].X, path[0].Y)) != nil {
+			if err := n.GoTo(w, id, path[len(path)-1]); err != nil {
+				n.Stop(id)
+				continue
+			}
+			if path = n.paths[id]; len(path) == 0 {
+				continue // pushed onto the goal, GoTo stopped it
+			}
+		}
+
+		if err := w.Move(id, path[0].X, path[0].Y); err != nil {
+			n.Stop(id)
+			continue
+		}
+
+		n.last[id] = path[0]
+		if len(path) == 1 {
+			n.Stop(id)
+			continue
+		}
+		n.paths[id] = path[1:]
+	}
+}
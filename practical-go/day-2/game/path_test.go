@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFindPathBlocked(t *testing.T) {
+	w, _ := NewWorld(5, 5, Reject)
+	// A ring of obstacles around 2/2.
+	for y := 1; y <= 3; y++ {
+		for x := 1; x <= 3; x++ {
+			if x != 2 || y != 2 {
+				w.AddObstacle(x, y)
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		to   Point
+		err  error
+	}{
+		{"on an obstacle", Point{1, 1}, ErrBlocked},
+		{"outside", Point{5, 0}, ErrOutOfBounds},
+		{"walled in", Point{2, 2}, ErrNoPath},
+	}
+	for _, tc := range tests {
+		if path, err := w.FindPath(Point{0, 0}, tc.to, PathOptions{Diagonal: true}); !errors.Is(err, tc.err) {
+			t.Errorf("%s: path %v, error %v, want %v", tc.name, path, err, tc.err)
+		}
+	}
+
+	// 4/4 is free, but 3/4 and 4/3 are blocked and a diagonal step from 3/3 can't cut their corners.
+	w, _ = NewWorld(5, 5, Reject)
+	w.AddObstacle(3, 4)
+	w.AddObstacle(4, 3)
+	if path, err := w.FindPath(Point{0, 0}, Point{4, 4}, PathOptions{Diagonal: true}); !errors.Is(err, ErrNoPath) {
+		t.Errorf("path %v, error %v, want %v", path, err, ErrNoPath)
+	}
+}
+
+func TestFindPathCorners(t *testing.T) {
+	w, _ := NewWorld(5, 5, Reject)
+	opts := PathOptions{Heuristic: Octile, Diagonal: true}
+
+	path, err := w.FindPath(Point{0, 0}, Point{1, 1}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Point{{1, 1}}; !reflect.DeepEqual(path, want) {
+		t.Errorf("path %v, want %v", path, want)
+	}
+
+	// With 1/0 blocked the diagonal step would cut its corner, it has to go around.
+	w.AddObstacle(1, 0)
+	path, err = w.FindPath(Point{0, 0}, Point{1, 1}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Point{{0, 1}, {1, 1}}; !reflect.DeepEqual(path, want) {
+		t.Errorf("path %v, want %v", path, want)
+	}
+}
+
+// TestNavigatorAlreadyThere sends entities where they already are, which gives an empty path.
+func TestNavigatorAlreadyThere(t *testing.T) {
+	w, _ := NewWorld(10, 10, Reject)
+	p := Player{Name: "Karim", Item: Item{1, 1}}
+	id, _ := w.Add(&p)
+
+	nav := NewNavigator(PathOptions{})
+	if err := nav.GoTo(w, id, Point{1, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if nav.Walking(id) {
+		t.Error("walking to where it already is")
+	}
+	nav.Update(w, 1)
+
+	// Pushed onto its goal while walking to it.
+	if err := nav.GoTo(w, id, Point{5, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Move(id, 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	nav.Update(w, 2)
+	if nav.Walking(id) || p.X != 5 || p.Y != 1 {
+		t.Errorf("at %d/%d, walking: %v, want stopped at 5/1", p.X, p.Y, nav.Walking(id))
+	}
+}
+
+func TestNavigatorWalks(t *testing.T) {
+	w, _ := NewWorld(10, 10, Reject)
+	p := Player{Name: "Karim", Item: Item{1, 1}}
+	id, _ := w.Add(&p)
+
+	nav := NewNavigator(PathOptions{})
+	if err := nav.GoTo(w, id, Point{4, 1}); err != nil {
+		t.Fatal(err)
+	}
+	for tick := uint64(1); nav.Walking(id); tick++ {
+		if tick > 3 {
+			t.Fatalf("still walking after %d ticks", tick-1)
+		}
+		nav.Update(w, tick)
+		if p.X != 1+int(tick) {
+			t.Fatalf("tick %d at %d/%d", tick, p.X, p.Y)
+		}
+	}
+}
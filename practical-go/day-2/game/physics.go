@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNotFinite is returned when a Body would get an infinite or NaN position, velocity or acceleration: one of them
+// spreads to everything it's added to or multiplied with, and the body would end up nowhere.
+var ErrNotFinite = errors.New("not a finite number")
+
+// Behaviour is a Mover that also acts on its own, once per tick. dt is the length of a tick in seconds.
+//
+// It embeds Mover, so anything with a Behaviour still works with moveAll and World.Move. Simple movers satisfy it
+// too: *Item, and *Player through its embedded Item, have an Update that does nothing.
+type Behaviour interface {
+	Mover
+	Update(w *World, id ID, dt float64)
+}
+
+// Update does nothing, items only move when told to.
+func (i *Item) Update(w *World, id ID, dt float64) {}
+
+// UpdateBehaviours returns a function for Loop.OnTick calling Update on every entity that has a Behaviour, in id
+// order.
+func UpdateBehaviours(tickRate int) func(w *World, tick uint64) {
+	dt := 1 / float64(tickRate)
+	return func(w *World, tick uint64) {
+		w.Each(func(id ID, e Entity) {
+			if b, ok := e.(Behaviour); ok {
+				b.Update(w, id, dt)
+			}
+		})
+	}
+}
+
+// Body is an entity moved by physics. Its Item holds the cell it's in, PX/PY where it really is inside the world.
+// Velocities are in cells per second and accelerations in cells per second².
+type Body struct {
+	Item
+	PX, PY float64
+	VX, VY float64
+	AX, AY float64
+
+	// Friction is the fraction of the velocity lost every second, from 0 (none, it slides forever) to 1.
+	Friction float64
+	// Bounciness is the fraction of the velocity kept when bouncing off an edge or an obstacle, 1 loses nothing.
+	Bounciness float64
+}
+
+// NewBody returns a body at rest on x/y.
+func NewBody(x, y int) *Body {
+	return &Body{
+		Item:       Item{x, y},
+		PX:         float64(x),
+		PY:         float64(y),
+		Bounciness: 1,
+	}
+}
+
+// SetVelocity sets the velocity of the body, in cells per second.
+func (b *Body) SetVelocity(vx, vy float64) error {
+	if !finite(vx, vy) {
+		return fmt.Errorf("velocity %v/%v: %w", vx, vy, ErrNotFinite)
+	}
+	b.VX, b.VY = vx, vy
+	return nil
+}
+
+// SetAcceleration sets the acceleration of the body, in cells per second².
+func (b *Body) SetAcceleration(ax, ay float64) error {
+	if !finite(ax, ay) {
+		return fmt.Errorf("acceleration %v/%v: %w", ax, ay, ErrNotFinite)
+	}
+	b.AX, b.AY = ax, ay
+	return nil
+}
+
+// check returns an error if any field of the body isn't finite, e.g. in a save made by hand.
+func (b *Body) check() error {
+	if !finite(b.PX, b.PY, b.VX, b.VY, b.AX, b.AY, b.Friction, b.Bounciness) {
+		return fmt.Errorf("body %+v: %w", *b, ErrNotFinite)
+	}
+	return nil
+}
+
+// Move teleports the body, keeping its velocity. Moves made by Update land on the cell PX/PY is in, those keep the
+// position inside the cell.
+func (b *Body) Move(x, y int) {
+	if x != round(b.PX) || y != round(b.PY) {
+		b.PX, b.PY = float64(x), float64(y)
+	}
+	b.Item.Move(x, y)
+}
+
+// Update integrates the motion of the body over dt seconds, bouncing off the edges of the world and off obstacles.
+// The move goes through World.Move, so collisions fire as usual.
+func (b *Body) Update(w *World, id ID, dt float64) {
+	// Semi-implicit Euler: velocity first, then position with the new velocity. It's stable enough for a game,
+	// unlike the explicit version which gains energy over time.
+	b.VX += b.AX * dt
+	b.VY += b.AY * dt
+
+	keep := math.Pow(1-clampFloat(b.Friction, 0, 1), dt)
+	b.VX *= keep
+	b.VY *= keep
+
+	px, py := b.PX+b.VX*dt, b.PY+b.VY*dt
+	px, b.VX = b.bounce(px, b.VX, float64(w.Width-1))
+	py, b.VY = b.bounce(py, b.VY, float64(w.Height-1))
+
+	oldX, oldY := b.PX, b.PY
+	b.PX, b.PY = px, py
+
+	x, y := round(px), round(py)
+	if x == b.X && y == b.Y {
+		return // still in the same cell
+	}
+
+	err := w.Move(id, x, y)
+	if errors.Is(err, ErrBlocked) {
+		// Bounce off the obstacle: stay where we were and go back the way we came on the blocked axes.
+		b.PX, b.PY = oldX, oldY
+
+		flipX := x != b.X && w.Blocked(x, b.Y)
+		flipY := y != b.Y && w.Blocked(b.X, y)
+		if !flipX && !flipY {
+			// Only the diagonal cell is blocked, we hit its corner.
+			flipX, flipY = x != b.X, y != b.Y
+		}
+		if flipX {
+			b.VX = -b.VX * b.Bounciness
+		}
+		if flipY {
+			b.VY = -b.VY * b.Bounciness
+		}
+	}
+}
+
+// bounce reflects p back inside [0, max], reversing v when it does.
+func (b *Body) bounce(p, v, max float64) (float64, float64) {
+	if max <= 0 {
+		return 0, 0
+	}
+	if p >= 0 && p <= max {
+		return p, v
+	}
+	if math.IsInf(p, 0) || math.IsNaN(p) {
+		// A velocity large enough to overflow the position: there's no telling where it would be, stop on the edge.
+		if p > 0 {
+			return max, 0
+		}
+		return 0, 0
+	}
+
+	// Bouncing back and forth between 0 and max repeats every 2*max, fold p into that instead of reflecting it once
+	// per edge, a fast body can go past thousands of them in a tick. n is the number of edges it went past, each one
+	// reverses v and takes away some of it.
+	var n float64
+	if p < 0 {
+		n = math.Ceil(-p / max)
+	} else {
+		n = math.Ceil(p/max) - 1
+	}
+	p = math.Mod(p, 2*max)
+	if p < 0 {
+		p += 2 * max
+	}
+	if p > max {
+		p = 2*max - p
+	}
+
+	v *= math.Pow(b.Bounciness, n)
+	if math.Mod(n, 2) == 1 {
+		v = -v
+	}
+	return p, v
+}
+
+// finite reports whether every one of vs is neither infinite nor NaN.
+func finite(vs ...float64) bool {
+	for _, v := range vs {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
+}
+
+func clampFloat(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestBounce(t *testing.T) {
+	b := Body{Bounciness: 0.5}
+	// One reflection per edge, the way bounce used to work, to compare with.
+	reflect := func(p, v, max float64) (float64, float64) {
+		for p < 0 || p > max {
+			if p < 0 {
+				p = -p
+			} else {
+				p = 2*max - p
+			}
+			v = -v * b.Bounciness
+		}
+		return p, v
+	}
+
+	for _, p := range []float64{0, 3, 10, 10.5, 20, 25, -0.5, -10, -10.5, -31, 1234.5, -987.25} {
+		gotP, gotV := b.bounce(p, 8, 10)
+		wantP, wantV := reflect(p, 8, 10)
+		if math.Abs(gotP-wantP) > 1e-9 || math.Abs(gotV-wantV) > 1e-9 {
+			t.Errorf("bounce(%v) = %v, %v, want %v, %v", p, gotP, gotV, wantP, wantV)
+		}
+	}
+
+	for _, p := range []float64{1e300, -1e300, math.MaxFloat64, math.Inf(1), math.Inf(-1), math.NaN()} {
+		gotP, gotV := b.bounce(p, 1e300, 10)
+		if gotP < 0 || gotP > 10 || !finite(gotV) {
+			t.Errorf("bounce(%v) = %v, %v, want inside [0, 10]", p, gotP, gotV)
+		}
+	}
+}
+
+func TestBodyNotFinite(t *testing.T) {
+	b := NewBody(1, 1)
+	for _, v := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		if err := b.SetVelocity(1, v); !errors.Is(err, ErrNotFinite) {
+			t.Errorf("SetVelocity(1, %v): %v, want %v", v, err, ErrNotFinite)
+		}
+		if err := b.SetAcceleration(v, 1); !errors.Is(err, ErrNotFinite) {
+			t.Errorf("SetAcceleration(%v, 1): %v, want %v", v, err, ErrNotFinite)
+		}
+	}
+	if b.VX != 0 || b.VY != 0 || b.AX != 0 || b.AY != 0 {
+		t.Errorf("rejected values were set: %+v", b)
+	}
+
+	w, _ := NewWorld(10, 10, Reject)
+	b.PX = math.Inf(1)
+	w.Add(b)
+	s, err := w.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore(); !errors.Is(err, ErrNotFinite) {
+		t.Errorf("Restore: %v, want %v", err, ErrNotFinite)
+	}
+}
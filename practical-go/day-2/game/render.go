@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// Glyphs maps an entity Kind (see EntityState) to the rune drawing it. Kinds missing from the map are drawn with '?'.
+type Glyphs map[string]rune
+
+// DefaultGlyphs are used when a Renderer has no Glyphs. "obstacle" and "empty" are not entity kinds, but cells of the
+// world.
+var DefaultGlyphs = Glyphs{
+	"player":      '@',
+	"item":        '*',
+	"body":        'o',
+	"collectible": '$',
+	"obstacle":    '#',
+	"empty":       '.',
+}
+
+// priority decides what is drawn when several things end up in the same terminal cell, the highest wins.
+var priority = map[string]int{
+	"empty":       0,
+	"obstacle":    1,
+	"item":        2,
+	"collectible": 3,
+	"body":        4,
+	"player":      5,
+}
+
+// Frame is a world drawn on a Cols x Rows grid of runes.
+type Frame struct {
+	Cols, Rows int
+	Cells      []rune // row after row
+}
+
+// String returns the frame as lines, handy for golden files.
+func (f Frame) String() string {
+	var sb strings.Builder
+	for r := 0; r < f.Rows; r++ {
+		sb.WriteString(string(f.Cells[r*f.Cols : (r+1)*f.Cols]))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// DrawFrame draws w scaled down (or up) to cols x rows. Each terminal cell covers a rectangle of the world and shows
+// the most important thing in it, players over items over obstacles.
+func DrawFrame(w *World, cols, rows int, glyphs Glyphs) Frame {
+	if glyphs == nil {
+		glyphs = DefaultGlyphs
+	}
+
+	f := Frame{Cols: cols, Rows: rows, Cells: make([]rune, cols*rows)}
+	kinds := make([]string, cols*rows)
+	for i := range kinds {
+		kinds[i] = "empty"
+	}
+
+	put := func(x, y int, kind string) {
+		if !w.Contains(x, y) {
+			return // moved out with a direct Move, nowhere to draw it
+		}
+		c, r := x*cols/w.Width, y*rows/w.Height
+		if c >= cols || r >= rows {
+			return // a frame of 0 cols or rows
+		}
+		i := r*cols + c
+		if priority[kind] >= priority[kinds[i]] {
+			kinds[i] = kind
+		}
+	}
+
+	for _, p := range w.Obstacles() {
+		put(p.X, p.Y, "obstacle")
+	}
+	w.Each(func(id ID, e Entity) {
+		s := entityState(id, e)
+		put(s.X, s.Y, s.Kind)
+	})
+
+	for i, kind := range kinds {
+		g, ok := glyphs[kind]
+		if !ok {
+			g = '?'
+		}
+		f.Cells[i] = g
+	}
+	return f
+}
+
+// RenderString draws w on cols x rows and returns it as text, without any escape codes. It's the headless mode of
+// the Renderer, for tests and logs.
+func RenderString(w *World, cols, rows int) string {
+	return DrawFrame(w, cols, rows, nil).String()
+}
+
+// Renderer draws a world on an ANSI terminal.
+//
+// It's double buffered: every Draw renders the new frame in the back buffer, compares it with the front buffer (what
+// is on the screen) and only writes the cells that changed, then swaps the buffers. Redrawing only the difference, in
+// a single write, is what avoids the flicker of clearing and redrawing the whole screen.
+type Renderer struct {
+	Out    io.Writer
+	Glyphs Glyphs // DefaultGlyphs if nil
+
+	// Size, if not nil, returns the size of the terminal. It's called on the first Draw and after every Resize.
+	Size func() (cols, rows int)
+
+	cols, rows  int
+	front, back Frame
+	resized     atomic.Bool // set from the signal handling goroutine, read by Draw
+	full        bool        // the next Draw must redraw everything
+}
+
+// NewRenderer returns a Renderer writing to out, sized to the terminal when out is one.
+func NewRenderer(out io.Writer) *Renderer {
+	r := Renderer{Out: out, Size: terminalSize}
+	r.resized.Store(true)
+	return &r
+}
+
+// Resize tells the renderer the terminal changed size, the next Draw asks for the size again and redraws everything.
+// It's safe to call from any goroutine, e.g. the one handling SIGWINCH.
+func (r *Renderer) Resize() {
+	r.resized.Store(true)
+}
+
+// Draw draws w with a status line below it.
+func (r *Renderer) Draw(w *World, status string) error {
+	if r.resized.Swap(false) {
+		cols, rows := 80, 24
+		if r.Size != nil {
+			cols, rows = r.Size()
+		}
+		r.cols, r.rows = cols, rows-1 // keep the last line for the status
+		if r.rows < 1 {
+			r.rows = 1
+		}
+		r.full = true
+	}
+
+	r.back = DrawFrame(w, r.cols, r.rows, r.Glyphs)
+
+	var buf bytes.Buffer
+	if r.full {
+		buf.WriteString("\x1b[?25l\x1b[2J") // hide the cursor, clear the screen
+	}
+	r.diff(&buf)
+
+	// Status line, cleared to the end of the line as it can get shorter.
+	fmt.Fprintf(&buf, "\x1b[%d;1H%s\x1b[K", r.rows+1, status)
+
+	r.front, r.back = r.back, r.front
+	r.full = false
+
+	_, err := r.Out.Write(buf.Bytes())
+	return err
+}
+
+// Close shows the cursor again and moves it below the frame.
+func (r *Renderer) Close() error {
+	_, err := fmt.Fprintf(r.Out, "\x1b[%d;1H\x1b[?25h\n", r.rows+1)
+	return err
+}
+
+// diff writes the escape codes turning the front buffer into the back buffer. Consecutive changed cells on a row are
+// written as a single run, after a single cursor move.
+func (r *Renderer) diff(buf *bytes.Buffer) {
+	same := !r.full && r.front.Cols == r.back.Cols && r.front.Rows == r.back.Rows
+
+	for row := 0; row < r.back.Rows; row++ {
+		col := 0
+		for col < r.back.Cols {
+			i := row*r.back.Cols + col
+			if same && r.front.Cells[i] == r.back.Cells[i] {
+				col++
+				continue
+			}
+
+			// Escape codes count from 1.
+			fmt.Fprintf(buf, "\x1b[%d;%dH", row+1, col+1)
+			for col < r.back.Cols {
+				i := row*r.back.Cols + col
+				if same && r.front.Cells[i] == r.back.Cells[i] {
+					break
+				}
+				buf.WriteRune(r.back.Cells[i])
+				col++
+			}
+		}
+	}
+}
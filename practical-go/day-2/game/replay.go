@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// MoveCommand is a move recorded as an object, so it can be applied again, or taken back.
+type MoveCommand struct {
+	Seq  int   `json:"seq"`
+	ID   ID    `json:"id"`
+	From Point `json:"from"`
+	To   Point `json:"to"`
+}
+
+// Do applies the move. To is where the entity ended up, after the world Policy, so Do gives the same result whatever
+// the Policy is.
+func (c MoveCommand) Do(w *World) error {
+	return w.Move(c.ID, c.To.X, c.To.Y)
+}
+
+// Undo moves the entity back to where it was.
+func (c MoveCommand) Undo(w *World) error {
+	return w.Move(c.ID, c.From.X, c.From.Y)
+}
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// EventLog records every move made in a world. Together with the seed the world was built from, it's enough to replay
+// a whole session, e.g. to reproduce a bug report.
+//
+// The log is a stack with a cursor: Undo moves the cursor back and takes a move back, Redo moves it forward again,
+// and recording a new move throws away whatever was undone.
+type EventLog struct {
+	Seed   int64         `json:"seed"`
+	Events []MoveCommand `json:"events"`
+
+	cursor   int  // Events[:cursor] are applied, Events[cursor:] were undone
+	applying bool // set while the log itself moves entities, so it doesn't record its own moves
+}
+
+func NewEventLog(seed int64) *EventLog {
+	return &EventLog{Seed: seed}
+}
+
+// Attach records every move made in w from now on.
+func (l *EventLog) Attach(w *World) {
+	w.OnMove(func(w *World, id ID, from, to Point) {
+		if !l.applying {
+			l.Record(MoveCommand{ID: id, From: from, To: to})
+		}
+	})
+}
+
+// Record adds c at the cursor, dropping any undone moves.
+func (l *EventLog) Record(c MoveCommand) {
+	l.Events = l.Events[:l.cursor]
+	c.Seq = len(l.Events) + 1
+	l.Events = append(l.Events, c)
+	l.cursor = len(l.Events)
+}
+
+// Applied returns the moves that are currently applied, in order.
+func (l *EventLog) Applied() []MoveCommand {
+	return l.Events[:l.cursor]
+}
+
+// Undo takes back the last applied move.
+func (l *EventLog) Undo(w *World) error {
+	if l.cursor == 0 {
+		return ErrNothingToUndo
+	}
+
+	if err := l.apply(w, l.Events[l.cursor-1].Undo); err != nil {
+		return fmt.Errorf("undo: %w", err)
+	}
+	l.cursor--
+	return nil
+}
+
+// Redo applies again the last undone move.
+func (l *EventLog) Redo(w *World) error {
+	if l.cursor == len(l.Events) {
+		return ErrNothingToRedo
+	}
+
+	if err := l.apply(w, l.Events[l.cursor].Do); err != nil {
+		return fmt.Errorf("redo: %w", err)
+	}
+	l.cursor++
+	return nil
+}
+
+func (l *EventLog) apply(w *World, fn func(w *World) error) error {
+	l.applying = true
+	defer func() { l.applying = false }()
+
+	return fn(w)
+}
+
+// Replay builds the world of l.Seed with setup, NewSeededWorld if nil, and applies every applied move in order.
+// Collision callbacks and anything else hooked to the world must be registered by setup to run again.
+func (l *EventLog) Replay(setup func(seed int64) (*World, error)) (*World, error) {
+	if setup == nil {
+		setup = NewSeededWorld
+	}
+
+	w, err := setup(l.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range l.Applied() {
+		if err := c.Do(w); err != nil {
+			return nil, fmt.Errorf("replay move %d: %w", c.Seq, err)
+		}
+	}
+	return w, nil
+}
+
+// Save writes the applied moves as JSON, undone moves are left out.
+func (l *EventLog) Save(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(EventLog{Seed: l.Seed, Events: l.Applied()})
+}
+
+// SaveFile saves l to path, the same way SaveFile saves a world.
+func (l *EventLog) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := l.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadEventLog(r io.Reader) (*EventLog, error) {
+	var l EventLog
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, fmt.Errorf("load event log: %w", err)
+	}
+
+	for i, c := range l.Events {
+		if c.Seq != i+1 {
+			return nil, fmt.Errorf("load event log: event %d has seq %d", i+1, c.Seq)
+		}
+	}
+	l.cursor = len(l.Events)
+	return &l, nil
+}
+
+func LoadEventLogFile(path string) (*EventLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadEventLog(file)
+}
+
+// NewSeededWorld builds a world with obstacles, items and players placed at random. The same seed always gives the
+// same world: it uses its own rand.Rand instead of the global one, which other code could be drawing from.
+func NewSeededWorld(seed int64) (*World, error) {
+	rnd := rand.New(rand.NewSource(seed))
+
+	w, err := NewWorld(maxX, maxY, Clamp)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 50; i++ {
+		w.AddObstacle(rnd.Intn(w.Width), rnd.Intn(w.Height))
+	}
+
+	free := func() (int, int) {
+		for {
+			x, y := rnd.Intn(w.Width), rnd.Intn(w.Height)
+			if !w.Blocked(x, y) {
+				return x, y
+			}
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		x, y := free()
+		if _, err := w.Add(&Item{x, y}); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < 4; i++ {
+		x, y := free()
+		if _, err := w.Add(&Player{Name: fmt.Sprintf("player-%d", i+1), Item: Item{x, y}}); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
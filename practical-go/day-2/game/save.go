@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Save files come in two formats, both carrying the schema version and a CRC-32 checksum of the saved state:
+//
+//	JSON:   {"version":1,"checksum":3735928559,"state":{...}}
+//	Binary: "GSAV" | version uint16 | checksum uint32 | length uint32 | state
+//
+// The binary state is a sequence of varints and length prefixed strings, see encodeBinary.
+// Both formats are big endian where it matters and can be told apart by their first byte, so LoadWorld doesn't need
+// to be told which one it's reading.
+
+// Format is the encoding of a save file.
+type Format int
+
+const (
+	JSON Format = iota
+	Binary
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case Binary:
+		return "binary"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// schemaVersion is the version of SaveState written by this code. Bump it, and add a migration, every time the saved
+// data changes - e.g. when a field is added to Player.
+//
+//	1: world settings, items and players
+//	2: obstacles
+//	3: bodies
+//	4: player scores and inventories, collectibles
+const schemaVersion = 4
+
+// migrations upgrades a SaveState loaded from an older file. migrations[v] turns a version v state into a version v+1
+// one, so a file saved at version 1 goes through migrations[1], migrations[2] and so on up to schemaVersion.
+// Fields that didn't exist in the old file are left at their zero value by the decoders, migrations are where they
+// get their defaults.
+var migrations = map[int]func(s *SaveState) error{
+	3: func(s *SaveState) error {
+		for i := range s.Players {
+			s.Players[i].Inventory = Inventory{}
+		}
+		return nil
+	},
+}
+
+var (
+	ErrChecksum = errors.New("checksum mismatch")
+	ErrVersion  = errors.New("unsupported schema version")
+)
+
+var binaryMagic = []byte("GSAV")
+
+// SaveState is everything needed to rebuild a World.
+type SaveState struct {
+	Version int           `json:"-"` // kept in the file header
+	World   WorldSettings `json:"world"`
+	Items   []SavedItem   `json:"items"`
+	Players []SavedPlayer `json:"players"`
+	Bodies  []SavedBody   `json:"bodies,omitempty"` // since version 3
+
+	Collectibles []SavedCollectible `json:"collectibles,omitempty"` // since version 4
+}
+
+type WorldSettings struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Policy Policy `json:"policy"`
+	NextID ID     `json:"next_id"` // so ids are never reused, even the ones of removed entities
+
+	Obstacles []Point `json:"obstacles,omitempty"` // since version 2
+}
+
+type SavedItem struct {
+	ID ID `json:"id"`
+	Item
+}
+
+// SavedPlayer embeds Player, so the JSON has the fields of Player and its embedded Item side by side:
+// {"id":1,"Name":"Karim","X":200,"Y":300,"Score":0,"Inventory":{}}
+type SavedPlayer struct {
+	ID ID `json:"id"`
+	Player
+}
+
+type SavedBody struct {
+	ID ID `json:"id"`
+	Body
+}
+
+type SavedCollectible struct {
+	ID ID `json:"id"`
+	Collectible
+}
+
+// Save returns the state of w.
+func (w *World) Save() (*SaveState, error) {
+	s := SaveState{
+		Version: schemaVersion,
+		World: WorldSettings{
+			Width:  w.Width,
+			Height: w.Height,
+			Policy: w.Policy,
+			NextID: w.nextID,
+
+			Obstacles: w.Obstacles(),
+		},
+	}
+
+	var err error
+	w.Each(func(id ID, e Entity) {
+		switch e := e.(type) {
+		case *Player:
+			p := *e
+			p.Inventory = e.Inventory.Clone()
+			s.Players = append(s.Players, SavedPlayer{id, p})
+		case *Body:
+			s.Bodies = append(s.Bodies, SavedBody{id, *e})
+		case *Collectible:
+			s.Collectibles = append(s.Collectibles, SavedCollectible{id, *e})
+		case *Item:
+			s.Items = append(s.Items, SavedItem{id, *e})
+		default:
+			if err == nil {
+				err = fmt.Errorf("save: entity %d: can't save %T", id, e)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Restore builds a new World from s. The entities keep their ids.
+func (s *SaveState) Restore() (*World, error) {
+	w, err := NewWorld(s.World.Width, s.World.Height, s.World.Policy)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range s.World.Obstacles {
+		if err := w.AddObstacle(p.X, p.Y); err != nil {
+			return nil, fmt.Errorf("restore: %w", err)
+		}
+	}
+
+	type saved struct {
+		id ID
+		e  Entity
+	}
+	all := make([]saved, 0, len(s.Items)+len(s.Players)+len(s.Bodies)+len(s.Collectibles))
+	for i := range s.Items {
+		item := s.Items[i].Item // copy, the world shouldn't share memory with the save
+		all = append(all, saved{s.Items[i].ID, &item})
+	}
+	for i := range s.Players {
+		player := s.Players[i].Player
+		player.Inventory = player.Inventory.Clone()
+		all = append(all, saved{s.Players[i].ID, &player})
+	}
+	for i := range s.Bodies {
+		body := s.Bodies[i].Body
+		if err := body.check(); err != nil {
+			return nil, fmt.Errorf("restore entity %d: %w", s.Bodies[i].ID, err)
+		}
+		all = append(all, saved{s.Bodies[i].ID, &body})
+	}
+	for i := range s.Collectibles {
+		c := s.Collectibles[i].Collectible
+		all = append(all, saved{s.Collectibles[i].ID, &c})
+	}
+	// World.insert wants increasing ids.
+	sort.Slice(all, func(i, j int) bool { return all[i].id < all[j].id })
+
+	for _, v := range all {
+		if err := w.insert(v.id, v.e); err != nil {
+			return nil, fmt.Errorf("restore entity %d: %w", v.id, err)
+		}
+	}
+	if s.World.NextID > w.nextID {
+		w.nextID = s.World.NextID
+	}
+
+	return w, nil
+}
+
+// SaveWorld writes the state of w to out in the given format.
+func SaveWorld(out io.Writer, w *World, f Format) error {
+	s, err := w.Save()
+	if err != nil {
+		return err
+	}
+
+	switch f {
+	case JSON:
+		return encodeJSON(out, s)
+	case Binary:
+		return encodeBinaryFile(out, s)
+	default:
+		return fmt.Errorf("save: unknown format %d", f)
+	}
+}
+
+// LoadWorld reads a save file in either format, checks its checksum and migrates it to the current schema.
+func LoadWorld(r io.Reader) (*World, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+
+	var s *SaveState
+	if first[0] == binaryMagic[0] {
+		s, err = decodeBinaryFile(br)
+	} else {
+		s, err = decodeJSON(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+
+	if err := migrate(s); err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+	return s.Restore()
+}
+
+// SaveFile saves w to path. It writes to a temporary file first and renames it, so a crash halfway through never
+// leaves a truncated save behind.
+func SaveFile(path string, w *World, f Format) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if err := SaveWorld(tmp, w, f); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadFile(path string) (*World, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadWorld(file)
+}
+
+func migrate(s *SaveState) error {
+	if s.Version < 1 || s.Version > schemaVersion {
+		return fmt.Errorf("%w %d, this build reads 1 to %d", ErrVersion, s.Version, schemaVersion)
+	}
+
+	for s.Version < schemaVersion {
+		if fn := migrations[s.Version]; fn != nil {
+			if err := fn(s); err != nil {
+				return fmt.Errorf("migrate from version %d: %w", s.Version, err)
+			}
+		}
+		s.Version++
+	}
+	return nil
+}
+
+type jsonFile struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	State    json.RawMessage `json:"state"`
+}
+
+func encodeJSON(out io.Writer, s *SaveState) error {
+	state, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	// state is compact JSON, so it's copied as is in the file and the checksum can be checked on the same bytes.
+	return json.NewEncoder(out).Encode(jsonFile{
+		Version:  s.Version,
+		Checksum: crc32.ChecksumIEEE(state),
+		State:    state,
+	})
+}
+
+func decodeJSON(r io.Reader) (*SaveState, error) {
+	var f jsonFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+
+	if sum := crc32.ChecksumIEEE(f.State); sum != f.Checksum {
+		return nil, fmt.Errorf("%w: file says %08x, state is %08x", ErrChecksum, f.Checksum, sum)
+	}
+
+	var s SaveState
+	if err := json.Unmarshal(f.State, &s); err != nil {
+		return nil, err
+	}
+	s.Version = f.Version
+	return &s, nil
+}
+
+func encodeBinaryFile(out io.Writer, s *SaveState) error {
+	state := encodeBinary(s)
+
+	header := make([]byte, 0, len(binaryMagic)+2+4+4)
+	header = append(header, binaryMagic...)
+	header = binary.BigEndian.AppendUint16(header, uint16(s.Version))
+	header = binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(state))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(state)))
+
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	_, err := out.Write(state)
+	return err
+}
+
+func decodeBinaryFile(r io.Reader) (*SaveState, error) {
+	header := make([]byte, len(binaryMagic)+2+4+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if !bytes.Equal(header[:len(binaryMagic)], binaryMagic) {
+		return nil, fmt.Errorf("not a save file")
+	}
+
+	h := header[len(binaryMagic):]
+	version := int(binary.BigEndian.Uint16(h))
+	checksum := binary.BigEndian.Uint32(h[2:])
+	size := binary.BigEndian.Uint32(h[6:])
+
+	// size isn't checked yet, the checksum covers the state only: read what's there instead of allocating size bytes
+	// up front, so a corrupt header can't make us allocate gigabytes.
+	state, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+	if len(state) != int(size) {
+		return nil, fmt.Errorf("state: %w, header says %d bytes, file has %d", io.ErrUnexpectedEOF, size, len(state))
+	}
+	if sum := crc32.ChecksumIEEE(state); sum != checksum {
+		return nil, fmt.Errorf("%w: file says %08x, state is %08x", ErrChecksum, checksum, sum)
+	}
+
+	return decodeBinary(version, state)
+}
+
+// encodeBinary writes the state in the layout of schemaVersion:
+//
+//	width, height, policy, next id
+//	item count, then for each item: id, x, y
+//	player count, then for each player: id, name, x, y
+//	obstacle count, then for each obstacle: x, y (since version 2)
+//	body count, then for each body: id, x, y, px, py, vx, vy, ax, ay, friction, bounciness (since version 3)
+//	for each player, in the same order as above: score, kind count, then for each kind: kind, count (since version 4)
+//	collectible count, then for each collectible: id, x, y, kind, points (since version 4)
+//
+// The version 4 player data comes after everything else instead of inside the players, so the layout of the older
+// versions is a prefix of the new one.
+//
+// Every integer is a varint, every float its 8 IEEE 754 bytes and every string a varint length followed by its
+// bytes.
+func encodeBinary(s *SaveState) []byte {
+	var b []byte
+	b = binary.AppendVarint(b, int64(s.World.Width))
+	b = binary.AppendVarint(b, int64(s.World.Height))
+	b = binary.AppendVarint(b, int64(s.World.Policy))
+	b = binary.AppendVarint(b, int64(s.World.NextID))
+
+	b = binary.AppendUvarint(b, uint64(len(s.Items)))
+	for _, it := range s.Items {
+		b = binary.AppendVarint(b, int64(it.ID))
+		b = binary.AppendVarint(b, int64(it.X))
+		b = binary.AppendVarint(b, int64(it.Y))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.Players)))
+	for _, p := range s.Players {
+		b = binary.AppendVarint(b, int64(p.ID))
+		b = appendString(b, p.Name)
+		b = binary.AppendVarint(b, int64(p.X))
+		b = binary.AppendVarint(b, int64(p.Y))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.World.Obstacles)))
+	for _, o := range s.World.Obstacles {
+		b = binary.AppendVarint(b, int64(o.X))
+		b = binary.AppendVarint(b, int64(o.Y))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.Bodies)))
+	for _, body := range s.Bodies {
+		b = binary.AppendVarint(b, int64(body.ID))
+		b = binary.AppendVarint(b, int64(body.X))
+		b = binary.AppendVarint(b, int64(body.Y))
+		for _, f := range []float64{body.PX, body.PY, body.VX, body.VY, body.AX, body.AY, body.Friction, body.Bounciness} {
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+		}
+	}
+
+	for _, p := range s.Players {
+		b = binary.AppendVarint(b, int64(p.Score))
+		b = binary.AppendUvarint(b, uint64(len(p.Inventory)))
+		for _, kind := range p.Inventory.Kinds() { // sorted, the same state always gives the same bytes
+			b = appendString(b, kind)
+			b = binary.AppendVarint(b, int64(p.Inventory[kind]))
+		}
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.Collectibles)))
+	for _, c := range s.Collectibles {
+		b = binary.AppendVarint(b, int64(c.ID))
+		b = binary.AppendVarint(b, int64(c.X))
+		b = binary.AppendVarint(b, int64(c.Y))
+		b = appendString(b, c.Kind)
+		b = binary.AppendVarint(b, int64(c.Points))
+	}
+	return b
+}
+
+// decodeBinary reads a state written with the layout of the given version. When the layout changes, this is where
+// the older layouts keep being read, before migrations bring the state up to date.
+func decodeBinary(version int, state []byte) (*SaveState, error) {
+	if version < 1 || version > schemaVersion {
+		return nil, fmt.Errorf("%w %d, this build reads 1 to %d", ErrVersion, version, schemaVersion)
+	}
+
+	d := decoder{r: bytes.NewReader(state)}
+	s := SaveState{Version: version}
+	s.World.Width = d.int()
+	s.World.Height = d.int()
+	s.World.Policy = Policy(d.int())
+	s.World.NextID = ID(d.int())
+
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		var it SavedItem
+		it.ID = ID(d.int())
+		it.X, it.Y = d.int(), d.int()
+		s.Items = append(s.Items, it)
+	}
+
+	n = d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		var p SavedPlayer
+		p.ID = ID(d.int())
+		p.Name = d.string()
+		p.X, p.Y = d.int(), d.int()
+		s.Players = append(s.Players, p)
+	}
+
+	if version >= 2 {
+		n = d.count()
+		for i := 0; i < n && d.err == nil; i++ {
+			s.World.Obstacles = append(s.World.Obstacles, Point{d.int(), d.int()})
+		}
+	}
+
+	if version >= 3 {
+		n = d.count()
+		for i := 0; i < n && d.err == nil; i++ {
+			var body SavedBody
+			body.ID = ID(d.int())
+			body.X, body.Y = d.int(), d.int()
+			for _, f := range []*float64{&body.PX, &body.PY, &body.VX, &body.VY, &body.AX, &body.AY, &body.Friction, &body.Bounciness} {
+				*f = d.float()
+			}
+			s.Bodies = append(s.Bodies, body)
+		}
+	}
+
+	if version >= 4 {
+		for i := 0; i < len(s.Players) && d.err == nil; i++ {
+			p := &s.Players[i]
+			p.Score = d.int()
+			n = d.count()
+			p.Inventory = make(Inventory, n)
+			for j := 0; j < n && d.err == nil; j++ {
+				kind := d.string()
+				p.Inventory[kind] = d.int()
+			}
+		}
+
+		n = d.count()
+		for i := 0; i < n && d.err == nil; i++ {
+			var c SavedCollectible
+			c.ID = ID(d.int())
+			c.X, c.Y = d.int(), d.int()
+			c.Kind = d.string()
+			c.Points = d.int()
+			s.Collectibles = append(s.Collectibles, c)
+		}
+	}
+
+	if d.err == nil && d.r.Len() != 0 {
+		d.err = fmt.Errorf("%d trailing bytes", d.r.Len())
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("state: %w", d.err)
+	}
+	return &s, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads varints and strings, remembering the first error so the caller only checks once at the end.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return int(v)
+}
+
+// count reads a length, making sure it's not larger than what's left to read.
+func (d *decoder) count() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err == nil && v > uint64(d.r.Len()) {
+		err = fmt.Errorf("length %d larger than the %d bytes left", v, d.r.Len())
+	}
+	d.err = err
+	return int(v)
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	var b [8]byte
+	_, d.err = io.ReadFull(d.r, b[:])
+	return math.Float64frombits(binary.BigEndian.Uint64(b[:]))
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return string(b)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// The server protocol is one JSON Message per line, both ways.
+//
+//	client -> server: join (first message), move, ping, leave
+//	server -> client: welcome (answer to join), update (after every tick that changed something), error, kick
+//
+// Updates are delta compressed: the first one a client gets is Full and has every entity, the next ones only have the
+// entities that changed since the previous update that client got, plus the ids of the ones that left.
+
+// Message types.
+const (
+	MsgJoin    = "join"
+	MsgMove    = "move"
+	MsgPing    = "ping"
+	MsgLeave   = "leave"
+	MsgWelcome = "welcome"
+	MsgUpdate  = "update"
+	MsgError   = "error"
+	MsgKick    = "kick"
+)
+
+// Message is a single line of the protocol. Only the fields of its Type are set.
+type Message struct {
+	Type string `json:"type"`
+
+	Name string `json:"name,omitempty"` // join
+	X    int    `json:"x,omitempty"`    // move
+	Y    int    `json:"y,omitempty"`    // move
+
+	ID      ID            `json:"id,omitempty"`      // welcome
+	Tick    uint64        `json:"tick,omitempty"`    // welcome, update
+	Full    bool          `json:"full,omitempty"`    // update
+	Changed []EntityState `json:"changed,omitempty"` // update
+	Removed []ID          `json:"removed,omitempty"` // update
+	Error   string        `json:"error,omitempty"`   // error, kick
+}
+
+var ErrKicked = errors.New("kicked")
+
+// Server lets clients join the world of Loop as players. The loop must be running for clients to join.
+type Server struct {
+	Loop *Loop
+
+	// IdleTimeout is how long a client can stay silent before being kicked, clients should ping to stay connected.
+	// Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// Spawn, if not nil, returns where a new player starts. Players start at 0/0 otherwise.
+	Spawn func(w *World) (x, y int)
+
+	wg sync.WaitGroup
+}
+
+// Serve accepts connections on ln until ctx is cancelled, then closes ln and every connection and waits for them to
+// finish.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	defer s.wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.ServeConn(ctx, conn)
+		}()
+	}
+}
+
+// ServeConn runs a single client on conn until it leaves, is kicked or ctx is cancelled, and closes conn.
+// Tests can use it with one end of a net.Pipe, and a Client on the other end.
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := serverConn{conn: conn, enc: json.NewEncoder(conn)}
+	go func() {
+		<-ctx.Done()
+		conn.Close() // unblocks any read or write
+	}()
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	var msg Message
+	if err := s.read(conn, dec, &msg); err != nil {
+		return s.drop(&c, err)
+	}
+	if msg.Type != MsgJoin {
+		c.send(Message{Type: MsgError, Error: "first message must be join"})
+		return fmt.Errorf("expected join, got %q", msg.Type)
+	}
+
+	id, cmds, err := s.join(ctx, msg.Name)
+	if err != nil {
+		c.send(Message{Type: MsgError, Error: err.Error()})
+		return err
+	}
+	defer s.leave(id, cmds)
+
+	snaps, unsubscribe := s.Loop.Subscribe(8)
+	defer unsubscribe()
+
+	if err := c.send(Message{Type: MsgWelcome, ID: id, Tick: s.Loop.Tick()}); err != nil {
+		return err
+	}
+
+	go func() {
+		// The writer: turn snapshots into updates until the loop stops or the client goes away.
+		defer cancel()
+
+		var last map[ID]EntityState
+		for snap := range snaps {
+			update, next := delta(last, snap)
+			last = next
+			if !update.Full && len(update.Changed) == 0 && len(update.Removed) == 0 {
+				continue // nothing changed, don't send an empty update every tick
+			}
+			if err := c.send(update); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg Message
+		if err := s.read(conn, dec, &msg); err != nil {
+			return s.drop(&c, err)
+		}
+
+		switch msg.Type {
+		case MsgMove:
+			select {
+			case cmds <- Command{msg.X, msg.Y}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case MsgPing:
+		case MsgLeave:
+			return nil
+		default:
+			c.send(Message{Type: MsgError, Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+		}
+	}
+}
+
+// read reads the next message, giving the client IdleTimeout to send it.
+func (s *Server) read(conn net.Conn, dec *json.Decoder, msg *Message) error {
+	if s.IdleTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+	}
+	return dec.Decode(msg)
+}
+
+// drop tells the client why it's being dropped, when it's still there to hear it.
+func (s *Server) drop(c *serverConn, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.send(Message{Type: MsgKick, Error: "idle"})
+		return ErrKicked
+	}
+	if errors.Is(err, io.EOF) {
+		return nil // client hung up
+	}
+	return err
+}
+
+// join adds a player to the world, from the loop goroutine, and registers its command channel.
+func (s *Server) join(ctx context.Context, name string) (ID, chan Command, error) {
+	type result struct {
+		id  ID
+		err error
+	}
+
+	cmds := make(chan Command, 16)
+	done := make(chan result, 1)
+	s.Loop.Do(func(w *World) {
+		if ctx.Err() != nil {
+			done <- result{err: ctx.Err()} // gave up waiting, don't leave a player nobody controls
+			return
+		}
+
+		p := Player{Name: name}
+		if s.Spawn != nil {
+			p.X, p.Y = s.Spawn(w)
+		}
+
+		id, err := w.Add(&p)
+		if err == nil {
+			s.Loop.Input(id, cmds)
+		}
+		done <- result{id, err}
+	})
+
+	select {
+	case r := <-done:
+		return r.id, cmds, r.err
+	case <-ctx.Done():
+		// The player may have been added anyway, if ctx was cancelled right after the check above. The loop runs the
+		// calls in order, so this one runs after it and undoes it.
+		s.Loop.Do(func(w *World) {
+			if r := <-done; r.err == nil {
+				close(cmds)
+				w.Remove(r.id)
+			}
+		})
+		return 0, nil, ctx.Err()
+	}
+}
+
+// leave unregisters the player and removes it from the world.
+func (s *Server) leave(id ID, cmds chan Command) {
+	close(cmds)
+	s.Loop.Do(func(w *World) {
+		w.Remove(id)
+	})
+}
+
+// delta returns the update taking a client from last to snap, and the state to diff the next snapshot against.
+// A nil last means the client has nothing yet and gets a full update.
+func delta(last map[ID]EntityState, snap Snapshot) (Message, map[ID]EntityState) {
+	update := Message{Type: MsgUpdate, Tick: snap.Tick, Full: last == nil}
+
+	next := make(map[ID]EntityState, len(snap.Entities))
+	for _, e := range snap.Entities {
+		next[e.ID] = e
+		if old, ok := last[e.ID]; !ok || old != e {
+			update.Changed = append(update.Changed, e)
+		}
+	}
+	for id := range last {
+		if _, ok := next[id]; !ok {
+			update.Removed = append(update.Removed, id)
+		}
+	}
+	// last is a map, sort so the same snapshots always give the same update.
+	sortIDs(update.Removed)
+
+	return update, next
+}
+
+// serverConn serializes the writes to a connection, both the reader and the writer goroutines send messages.
+type serverConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+	enc  *json.Encoder
+}
+
+func (c *serverConn) send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.enc.Encode(msg)
+}
+
+// Client is the client side of the protocol. It keeps its own copy of the world, rebuilt from the updates.
+// It's not safe for concurrent use, except that Move and Ping can be called while another goroutine is in Next.
+type Client struct {
+	conn  net.Conn
+	dec   *json.Decoder
+	mu    sync.Mutex // guards enc
+	enc   *json.Encoder
+	ID    ID
+	World map[ID]EntityState
+}
+
+func NewClient(conn net.Conn) *Client {
+	return &Client{
+		conn:  conn,
+		dec:   json.NewDecoder(bufio.NewReader(conn)),
+		enc:   json.NewEncoder(conn),
+		World: make(map[ID]EntityState),
+	}
+}
+
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// Join joins the game as name and waits for the server to welcome it.
+func (c *Client) Join(name string) error {
+	if err := c.send(Message{Type: MsgJoin, Name: name}); err != nil {
+		return err
+	}
+
+	var msg Message
+	if err := c.dec.Decode(&msg); err != nil {
+		return err
+	}
+	if msg.Type != MsgWelcome {
+		return fmt.Errorf("join: %s %s", msg.Type, msg.Error)
+	}
+	c.ID = msg.ID
+	return nil
+}
+
+func (c *Client) Move(x, y int) error {
+	return c.send(Message{Type: MsgMove, X: x, Y: y})
+}
+
+func (c *Client) Ping() error {
+	return c.send(Message{Type: MsgPing})
+}
+
+// Leave tells the server we're leaving and closes the connection.
+func (c *Client) Leave() error {
+	err := c.send(Message{Type: MsgLeave})
+	c.conn.Close()
+	return err
+}
+
+// Next waits for the next update and applies it to c.World. Error messages from the server are returned as errors,
+// and being kicked as ErrKicked.
+func (c *Client) Next() (Message, error) {
+	for {
+		var msg Message
+		if err := c.dec.Decode(&msg); err != nil {
+			return Message{}, err
+		}
+
+		switch msg.Type {
+		case MsgUpdate:
+			if msg.Full {
+				c.World = make(map[ID]EntityState, len(msg.Changed))
+			}
+			for _, e := range msg.Changed {
+				c.World[e.ID] = e
+			}
+			for _, id := range msg.Removed {
+				delete(c.World, id)
+			}
+			return msg, nil
+		case MsgKick:
+			return msg, fmt.Errorf("%w: %s", ErrKicked, msg.Error)
+		case MsgError:
+			return msg, errors.New(msg.Error)
+		}
+	}
+}
+
+func (c *Client) send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.enc.Encode(msg)
+}
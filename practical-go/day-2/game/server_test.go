@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// The tests drive the loop with Step instead of Run, so they decide when a tick happens. Each one runs ServeConn on
+// one end of a net.Pipe and a Client on the other.
+
+func TestServerUpdates(t *testing.T) {
+	l, s, item := newTestServer(t)
+	c, served := servePipe(t, context.Background(), s)
+	join(t, l, c, "Karim")
+
+	l.Step()
+	msg := next(t, c)
+	if !msg.Full || len(msg.Changed) != 2 || len(c.World) != 2 {
+		t.Fatalf("first update %+v, want a full one with both entities", msg)
+	}
+
+	if err := c.Move(3, 4); err != nil {
+		t.Fatal(err)
+	}
+	// The server reads the ping only once it handed the move to the loop.
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	l.Step()
+	msg = next(t, c)
+	if msg.Full || len(msg.Changed) != 1 || msg.Changed[0].ID != c.ID {
+		t.Fatalf("update %+v, want only the player", msg)
+	}
+	if p := c.World[c.ID]; p.X != 3 || p.Y != 4 {
+		t.Fatalf("player at %d/%d, want 3/4", p.X, p.Y)
+	}
+
+	tick := l.Step().Tick // nothing changes, no update
+	l.Do(func(w *World) { w.Remove(item) })
+	l.Step()
+	msg = next(t, c)
+	if msg.Tick != tick+1 || len(msg.Changed) != 0 || len(msg.Removed) != 1 || msg.Removed[0] != item {
+		t.Fatalf("update %+v, want tick %d removing %d", msg, tick+1, item)
+	}
+	if len(c.World) != 1 {
+		t.Fatalf("client world %v, want only the player", c.World)
+	}
+
+	if err := c.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(t, served); err != nil {
+		t.Fatalf("ServeConn: %v", err)
+	}
+	l.Step() // removes the player
+	if n := l.World.Len(); n != 0 {
+		t.Fatalf("%d entities after leaving, want none", n)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	l, s, _ := newTestServer(t)
+	s.IdleTimeout = 50 * time.Millisecond
+	c, served := servePipe(t, context.Background(), s)
+	join(t, l, c, "Karim")
+
+	if _, err := c.Next(); !errors.Is(err, ErrKicked) {
+		t.Fatalf("Next: %v, want %v", err, ErrKicked)
+	}
+	if err := wait(t, served); !errors.Is(err, ErrKicked) {
+		t.Fatalf("ServeConn: %v, want %v", err, ErrKicked)
+	}
+}
+
+// TestServerJoinCanceled gives up on joining before the loop ran the join, and right after it did: the player must
+// not stay in the world either way.
+func TestServerJoinCanceled(t *testing.T) {
+	t.Run("before", func(t *testing.T) {
+		l, s, _ := newTestServer(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		c, served := servePipe(t, ctx, s)
+		go c.Join("Karim")
+
+		waitCalls(t, l)
+		cancel()
+		if err := wait(t, served); !errors.Is(err, context.Canceled) {
+			t.Fatalf("ServeConn: %v, want %v", err, context.Canceled)
+		}
+		checkLeft(t, l)
+	})
+
+	t.Run("after", func(t *testing.T) {
+		l, s, _ := newTestServer(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		s.Spawn = func(w *World) (int, int) {
+			cancel() // the player is added right after
+			return 0, 0
+		}
+		c, served := servePipe(t, ctx, s)
+		go c.Join("Karim")
+
+		waitCalls(t, l)
+		l.Step()
+		wait(t, served)
+		checkLeft(t, l)
+	})
+}
+
+// newTestServer returns a server over a 10x10 world holding an item.
+func newTestServer(t *testing.T) (*Loop, *Server, ID) {
+	t.Helper()
+	w, err := NewWorld(10, 10, Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := w.Add(&Item{5, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLoop(w, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, &Server{Loop: l}, item
+}
+
+// servePipe runs s on one end of a pipe and returns a Client on the other, and what ServeConn returns.
+func servePipe(t *testing.T, ctx context.Context, s *Server) (*Client, <-chan error) {
+	server, client := net.Pipe()
+	served := make(chan error, 1)
+	go func() { served <- s.ServeConn(ctx, server) }()
+	t.Cleanup(func() { client.Close() })
+	return NewClient(client), served
+}
+
+// join joins c, stepping the loop once the server asked it to add the player.
+func join(t *testing.T, l *Loop, c *Client, name string) {
+	t.Helper()
+	joined := make(chan error, 1)
+	go func() { joined <- c.Join(name) }()
+	waitCalls(t, l)
+	l.Step()
+	if err := wait(t, joined); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+}
+
+// waitCalls waits for a call to be queued with Loop.Do.
+func waitCalls(t *testing.T, l *Loop) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		n := len(l.calls)
+		l.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("nothing queued with Do")
+}
+
+// checkLeft checks that a canceled join left only the item in the world, and no input behind.
+func checkLeft(t *testing.T, l *Loop) {
+	t.Helper()
+	l.Step() // runs whatever undoes the join
+	if n := l.World.Len(); n != 1 {
+		t.Errorf("%d entities, want only the item", n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.inputs) != 0 {
+		t.Errorf("%d inputs left, want none", len(l.inputs))
+	}
+}
+
+func next(t *testing.T, c *Client) Message {
+	t.Helper()
+	done := make(chan error, 1)
+	var msg Message
+	go func() {
+		var err error
+		msg, err = c.Next()
+		done <- err
+	}()
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	return msg
+}
+
+func wait(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+		return nil
+	}
+}
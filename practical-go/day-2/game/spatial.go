@@ -0,0 +1,255 @@
+package main
+
+import (
+	"math"
+
+	"day2/sliceutil"
+)
+
+// Rect is an axis aligned bounding box, covering X to X+W-1 and Y to Y+H-1.
+type Rect struct {
+	X, Y int
+	W, H int
+}
+
+// Overlaps reports whether r and o share at least one cell.
+func (r Rect) Overlaps(o Rect) bool {
+	return r.X < o.X+o.W && o.X < r.X+r.W && r.Y < o.Y+o.H && o.Y < r.Y+r.H
+}
+
+// distSq returns the squared distance from x/y to the closest point of r, 0 if x/y is inside r.
+func (r Rect) distSq(x, y int) int {
+	dx := 0
+	if x < r.X {
+		dx = r.X - x
+	} else if x > r.X+r.W-1 {
+		dx = x - (r.X + r.W - 1)
+	}
+
+	dy := 0
+	if y < r.Y {
+		dy = r.Y - y
+	} else if y > r.Y+r.H-1 {
+		dy = y - (r.Y + r.H - 1)
+	}
+
+	return dx*dx + dy*dy
+}
+
+// Items are a single cell.
+func (i *Item) Bounds() Rect {
+	return Rect{i.X, i.Y, 1, 1}
+}
+
+const playerSize = 2
+
+// Players are bigger than items. Defining Bounds on Player shadows the one promoted from Item, this is how embedding
+// lets the outer type override behavior.
+func (p *Player) Bounds() Rect {
+	return Rect{p.X, p.Y, playerSize, playerSize}
+}
+
+type cell struct {
+	x, y int
+}
+
+// Grid is a uniform grid spatial index. The plane is split in square cells of the same size, and every box is stored
+// in each cell it touches, so a query only has to look at the cells it covers instead of at every box.
+//
+// Grid only stores IDs and boxes, it knows nothing about entities. It's not safe for concurrent use.
+type Grid struct {
+	size  int
+	cells map[cell][]ID
+	boxes map[ID]Rect
+
+	// Range of cells that have ever been used, it bounds how far Nearest has to search.
+	min, max cell
+}
+
+// NewGrid returns an empty grid with square cells of size x size. Cells of about the size of the boxes stored work
+// best. Panics if size < 1.
+func NewGrid(size int) *Grid {
+	if size < 1 {
+		panic("game: grid cell size must be positive")
+	}
+
+	g := Grid{
+		size:  size,
+		cells: make(map[cell][]ID),
+		boxes: make(map[ID]Rect),
+	}
+	return &g
+}
+
+// Len returns the number of boxes in the grid.
+func (g *Grid) Len() int {
+	return len(g.boxes)
+}
+
+// Insert adds id with the box r. Inserting an id that is already in the grid moves it.
+func (g *Grid) Insert(id ID, r Rect) {
+	if _, ok := g.boxes[id]; ok {
+		g.Remove(id)
+	}
+
+	if len(g.boxes) == 0 && len(g.cells) == 0 {
+		g.min, g.max = g.cellOf(r.X, r.Y), g.cellOf(r.X, r.Y)
+	}
+
+	g.boxes[id] = r
+	g.eachCell(r, func(c cell) {
+		g.cells[c] = append(g.cells[c], id)
+
+		g.min.x, g.min.y = minInt(g.min.x, c.x), minInt(g.min.y, c.y)
+		g.max.x, g.max.y = maxInt(g.max.x, c.x), maxInt(g.max.y, c.y)
+	})
+}
+
+// Move updates the box of id to r.
+func (g *Grid) Move(id ID, r Rect) {
+	if old, ok := g.boxes[id]; ok && g.cellsOf(old) == g.cellsOf(r) {
+		// Still in the same cells, only the box changes.
+		g.boxes[id] = r
+		return
+	}
+	g.Insert(id, r)
+}
+
+// Remove deletes id from the grid, it reports whether it was there.
+func (g *Grid) Remove(id ID) bool {
+	r, ok := g.boxes[id]
+	if !ok {
+		return false
+	}
+
+	delete(g.boxes, id)
+	g.eachCell(r, func(c cell) {
+		ids := sliceutil.Filter(g.cells[c], func(v ID) bool { return v != id })
+		if len(ids) == 0 {
+			delete(g.cells, c)
+			return
+		}
+		g.cells[c] = ids
+	})
+	return true
+}
+
+// Box returns the box of id.
+func (g *Grid) Box(id ID) (Rect, bool) {
+	r, ok := g.boxes[id]
+	return r, ok
+}
+
+// Query returns the ids of every box overlapping r, in increasing order.
+func (g *Grid) Query(r Rect) []ID {
+	var ids []ID
+	g.eachCell(r, func(c cell) {
+		for _, id := range g.cells[c] {
+			if g.boxes[id].Overlaps(r) {
+				ids = append(ids, id)
+			}
+		}
+	})
+
+	// A box spanning several cells is found once per cell. Once sorted the duplicates are next to each other, no need
+	// for the map of sliceutil.Dedupe.
+	sortIDs(ids)
+	n := 0
+	for i, id := range ids {
+		if i == 0 || id != ids[n-1] {
+			ids[n] = id
+			n++
+		}
+	}
+	return ids[:n]
+}
+
+// Nearest returns the id whose box is closest to x/y and for which match returns true, a nil match matches every id.
+// Ties are broken by the lowest id. It reports false if nothing matched.
+func (g *Grid) Nearest(x, y int, match func(ID) bool) (ID, bool) {
+	if len(g.boxes) == 0 {
+		return 0, false
+	}
+
+	origin := g.cellOf(x, y)
+	maxRing := maxInt(
+		maxInt(absInt(origin.x-g.min.x), absInt(g.max.x-origin.x)),
+		maxInt(absInt(origin.y-g.min.y), absInt(g.max.y-origin.y)),
+	)
+
+	best, bestDist, found := ID(0), math.MaxInt, false
+	// Search square rings of cells around the origin cell, moving out one ring at a time.
+	for ring := 0; ring <= maxRing; ring++ {
+		for cx := origin.x - ring; cx <= origin.x+ring; cx++ {
+			for cy := origin.y - ring; cy <= origin.y+ring; cy++ {
+				if absInt(cx-origin.x) != ring && absInt(cy-origin.y) != ring {
+					continue // inner rings were already searched
+				}
+				for _, id := range g.cells[cell{cx, cy}] {
+					if match != nil && !match(id) {
+						continue
+					}
+					d := g.boxes[id].distSq(x, y)
+					if d < bestDist || (d == bestDist && id < best) {
+						best, bestDist, found = id, d, true
+					}
+				}
+			}
+		}
+
+		// Anything past this ring is at least ring * size away.
+		if found && bestDist <= (ring*g.size)*(ring*g.size) {
+			break
+		}
+	}
+
+	return best, found
+}
+
+// cellOf returns the cell holding x/y. Integer division rounds toward zero, so negative coordinates need flooring.
+func (g *Grid) cellOf(x, y int) cell {
+	return cell{floorDiv(x, g.size), floorDiv(y, g.size)}
+}
+
+// cellsOf returns the first and last cell touched by r.
+func (g *Grid) cellsOf(r Rect) [2]cell {
+	return [2]cell{g.cellOf(r.X, r.Y), g.cellOf(r.X+r.W-1, r.Y+r.H-1)}
+}
+
+func (g *Grid) eachCell(r Rect, fn func(c cell)) {
+	span := g.cellsOf(r)
+	for cx := span[0].x; cx <= span[1].x; cx++ {
+		for cy := span[0].y; cy <= span[1].y; cy++ {
+			fn(cell{cx, cy})
+		}
+	}
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
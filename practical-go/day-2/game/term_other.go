@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import "context"
+
+// terminalSize can't ask the terminal on this platform, it always returns 80x24.
+func terminalSize() (cols, rows int) {
+	return 80, 24
+}
+
+// watchResize does nothing, there is no SIGWINCH on this platform.
+func watchResize(ctx context.Context, r *Renderer) {}
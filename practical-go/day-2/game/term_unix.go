@@ -0,0 +1,44 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// terminalSize asks the terminal on stdout for its size, with the TIOCGWINSZ ioctl. It falls back to 80x24 when
+// stdout is not a terminal.
+func terminalSize() (cols, rows int) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.cols == 0 || ws.rows == 0 {
+		return 80, 24
+	}
+	return int(ws.cols), int(ws.rows)
+}
+
+// watchResize calls r.Resize every time the terminal is resized (SIGWINCH), until ctx is cancelled.
+func watchResize(ctx context.Context, r *Renderer) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				r.Resize()
+			}
+		}
+	}()
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"day2/sliceutil"
+)
+
+// Policy decides what a World does with a move that would take an entity out of its bounds.
+type Policy int
+
+const (
+	Reject Policy = iota // refuse the move and return ErrOutOfBounds
+	Clamp                // stop the entity at the closest edge
+	Wrap                 // wrap around to the opposite edge, the world is a torus
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Reject:
+		return "reject"
+	case Clamp:
+		return "clamp"
+	case Wrap:
+		return "wrap"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+var (
+	ErrOutOfBounds = errors.New("out of bounds")
+	ErrBlocked     = errors.New("blocked by an obstacle")
+)
+
+// Point is a cell of the world.
+type Point struct {
+	X, Y int
+}
+
+// ID identifies an entity in a World. IDs are handed out in increasing order and never reused.
+type ID int
+
+// Entity is anything a World can hold - it can be moved, it knows where it is and how much space it takes.
+// Both *Item and *Player are entities, Player gets Position promoted from its embedded Item.
+type Entity interface {
+	Mover
+	Position() (x, y int)
+	Bounds() Rect
+}
+
+// MoveFunc is called after the entity id moved from from to to.
+type MoveFunc func(w *World, id ID, from, to Point)
+
+// CollisionFunc is called when the entity mover is moved onto the entity other, that is when their Bounds overlap.
+type CollisionFunc func(w *World, mover, other ID)
+
+func (i *Item) Position() (int, int) {
+	return i.X, i.Y
+}
+
+// World owns a Width x Height area, with valid coordinates going from 0 to Width-1 and 0 to Height-1, and every
+// entity living in it. Entities should only be moved through the World, as calling Move on them directly skips the
+// bounds checks.
+type World struct {
+	Width  int
+	Height int
+	Policy Policy
+
+	nextID   ID
+	ids      []ID // kept in increasing order, so iterating is deterministic (map order is random)
+	entities map[ID]Entity
+
+	index     *Grid
+	onCollide []CollisionFunc
+	onMove    []MoveFunc
+	obstacles map[Point]struct{}
+}
+
+// gridCellSize is the size of the cells of the World spatial index, a few times the size of a player.
+const gridCellSize = 16
+
+func NewWorld(width, height int, policy Policy) (*World, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("bad world size %dx%d", width, height)
+	}
+
+	w := World{
+		Width:     width,
+		Height:    height,
+		Policy:    policy,
+		entities:  make(map[ID]Entity),
+		index:     NewGrid(gridCellSize),
+		obstacles: make(map[Point]struct{}),
+	}
+	return &w, nil
+}
+
+// Contains reports whether x/y is inside the world.
+func (w *World) Contains(x, y int) bool {
+	return x >= 0 && x < w.Width && y >= 0 && y < w.Height
+}
+
+// Add puts e in the world. e must already be inside the world, the Policy only applies to moves.
+func (w *World) Add(e Entity) (ID, error) {
+	id := w.nextID + 1
+	if err := w.insert(id, e); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// insert puts e in the world under id, which must be higher than every id handed out so far.
+// Add uses the next free id, loading a save uses the saved ones.
+func (w *World) insert(id ID, e Entity) error {
+	if id <= w.nextID {
+		return fmt.Errorf("add: id %d already used", id)
+	}
+
+	x, y := e.Position()
+	if err := w.fits(e.Bounds()); err != nil {
+		return fmt.Errorf("add %d/%d: %w", x, y, err)
+	}
+
+	w.nextID = id
+	w.ids = append(w.ids, id)
+	w.entities[id] = e
+	w.index.Insert(id, e.Bounds())
+	return nil
+}
+
+// Remove takes the entity out of the world, it reports whether it was there.
+func (w *World) Remove(id ID) bool {
+	if _, ok := w.entities[id]; !ok {
+		return false
+	}
+
+	delete(w.entities, id)
+	w.index.Remove(id)
+	for i, v := range w.ids {
+		if v == id {
+			w.ids = append(w.ids[:i], w.ids[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Entity returns the entity with the given id.
+func (w *World) Entity(id ID) (Entity, bool) {
+	e, ok := w.entities[id]
+	return e, ok
+}
+
+// Len returns the number of entities in the world.
+func (w *World) Len() int {
+	return len(w.ids)
+}
+
+// Each calls fn for every entity in the world, in the order they were added.
+// fn must not add or remove entities.
+func (w *World) Each(fn func(id ID, e Entity)) {
+	for _, id := range w.ids {
+		fn(id, w.entities[id])
+	}
+}
+
+// Move moves the entity to x/y, applying the world Policy if x/y is out of bounds.
+func (w *World) Move(id ID, x, y int) error {
+	e, ok := w.entities[id]
+	if !ok {
+		return fmt.Errorf("move: unknown entity %d", id)
+	}
+
+	box, err := w.resolve(boxAt(e, x, y))
+	if err != nil {
+		return fmt.Errorf("move entity %d: %w", id, err)
+	}
+	if err := w.fits(box); err != nil {
+		return fmt.Errorf("move entity %d to %d/%d: %w", id, box.X, box.Y, err)
+	}
+
+	w.place(id, e, box.X, box.Y)
+	return nil
+}
+
+// MoveAll moves every entity to x/y. It's the World version of moveAll, so it goes through the same Policy as Move.
+func (w *World) MoveAll(x, y int) error {
+	// Resolve every entity up front, so with Reject either every entity moves or none of them does. Entities of
+	// different sizes can end up in different places when the Policy clamps or wraps.
+	to := make(map[ID]Rect, len(w.ids))
+	for _, id := range w.ids {
+		box, err := w.resolve(boxAt(w.entities[id], x, y))
+		if err != nil {
+			return fmt.Errorf("move all: %w", err)
+		}
+		if err := w.fits(box); err != nil {
+			return fmt.Errorf("move all to %d/%d: %w", box.X, box.Y, err)
+		}
+		to[id] = box
+	}
+
+	// Collision callbacks may remove entities, so range over a copy of the ids.
+	for _, id := range sliceutil.Clone(w.ids) {
+		if e, ok := w.entities[id]; ok {
+			w.place(id, e, to[id].X, to[id].Y)
+		}
+	}
+	return nil
+}
+
+// AddObstacle blocks the cell x/y, entities can't be added or moved there. Entities already there stay.
+func (w *World) AddObstacle(x, y int) error {
+	if !w.Contains(x, y) {
+		return fmt.Errorf("obstacle %d/%d: %w %d/%d", x, y, ErrOutOfBounds, w.Width, w.Height)
+	}
+	w.obstacles[Point{x, y}] = struct{}{}
+	return nil
+}
+
+func (w *World) RemoveObstacle(x, y int) {
+	delete(w.obstacles, Point{x, y})
+}
+
+// Blocked reports whether there's an obstacle on x/y.
+func (w *World) Blocked(x, y int) bool {
+	_, ok := w.obstacles[Point{x, y}]
+	return ok
+}
+
+// fits returns ErrOutOfBounds or ErrBlocked if an entity can't be on box. Every cell of the box counts, not only the
+// top-left one the entity's position is: a player is 2x2, it can't stand with its right half over the edge or on an
+// obstacle.
+func (w *World) fits(box Rect) error {
+	if box.X < 0 || box.Y < 0 || box.X+box.W > w.Width || box.Y+box.H > w.Height {
+		return fmt.Errorf("%d/%d %w %d/%d", box.X, box.Y, ErrOutOfBounds, w.Width, w.Height)
+	}
+	for y := box.Y; y < box.Y+box.H; y++ {
+		for x := box.X; x < box.X+box.W; x++ {
+			if w.Blocked(x, y) {
+				return ErrBlocked
+			}
+		}
+	}
+	return nil
+}
+
+// boxAt returns the Bounds e would have on x/y.
+func boxAt(e Entity, x, y int) Rect {
+	box := e.Bounds()
+	return Rect{x, y, box.W, box.H}
+}
+
+// Obstacles returns every obstacle, sorted by row then column.
+func (w *World) Obstacles() []Point {
+	ps := make([]Point, 0, len(w.obstacles))
+	for p := range w.obstacles {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].Y != ps[j].Y {
+			return ps[i].Y < ps[j].Y
+		}
+		return ps[i].X < ps[j].X
+	})
+	return ps
+}
+
+// OnCollision registers fn to be called whenever a move makes two entities overlap. fn can remove entities from the
+// world, e.g. to pick something up.
+func (w *World) OnCollision(fn CollisionFunc) {
+	w.onCollide = append(w.onCollide, fn)
+}
+
+// OnMove registers fn to be called after every move made through the world, before the collisions it causes.
+func (w *World) OnMove(fn MoveFunc) {
+	w.onMove = append(w.onMove, fn)
+}
+
+// Query returns the ids of the entities whose Bounds overlap r, in increasing order.
+func (w *World) Query(r Rect) []ID {
+	return w.index.Query(r)
+}
+
+// Nearest returns the entity closest to x/y for which match returns true, a nil match matches every entity.
+func (w *World) Nearest(x, y int, match func(id ID, e Entity) bool) (ID, bool) {
+	var fn func(ID) bool
+	if match != nil {
+		fn = func(id ID) bool { return match(id, w.entities[id]) }
+	}
+	return w.index.Nearest(x, y, fn)
+}
+
+// place moves e to x/y, which must already be resolved, keeps the index up to date and fires the collisions.
+func (w *World) place(id ID, e Entity, x, y int) {
+	fromX, fromY := e.Position()
+	e.Move(x, y)
+	box := e.Bounds()
+	w.index.Move(id, box)
+
+	for _, fn := range w.onMove {
+		fn(w, id, Point{fromX, fromY}, Point{x, y})
+	}
+
+	if len(w.onCollide) == 0 {
+		return
+	}
+	for _, other := range w.index.Query(box) {
+		if other == id {
+			continue
+		}
+		for _, fn := range w.onCollide {
+			if w.entities[id] == nil || w.entities[other] == nil {
+				break // removed by an earlier callback
+			}
+			fn(w, id, other)
+		}
+	}
+}
+
+// resolve applies the world Policy to box and returns where the entity should end up. The whole box must end up
+// inside the world: Clamp and Wrap keep its top-left corner far enough from the right and bottom edges.
+func (w *World) resolve(box Rect) (Rect, error) {
+	maxX, maxY := w.Width-box.W, w.Height-box.H // last top-left corner that fits
+	if box.X >= 0 && box.X <= maxX && box.Y >= 0 && box.Y <= maxY {
+		return box, nil
+	}
+	if maxX < 0 || maxY < 0 {
+		return box, fmt.Errorf("%dx%d box %w %d/%d", box.W, box.H, ErrOutOfBounds, w.Width, w.Height)
+	}
+
+	switch w.Policy {
+	case Clamp:
+		box.X, box.Y = clamp(box.X, 0, maxX), clamp(box.Y, 0, maxY)
+		return box, nil
+	case Wrap:
+		box.X, box.Y = wrap(box.X, maxX+1), wrap(box.Y, maxY+1)
+		return box, nil
+	default:
+		return box, fmt.Errorf("%d/%d %w %d/%d", box.X, box.Y, ErrOutOfBounds, w.Width, w.Height)
+	}
+}
+
+func sortIDs(ids []ID) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// wrap returns v modulo n, always in [0, n). Go's % keeps the sign of v, so -1 % 10 is -1 and not 9.
+func wrap(v, n int) int {
+	v %= n
+	if v < 0 {
+		v += n
+	}
+	return v
+}
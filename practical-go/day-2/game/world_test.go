@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestMoveBounds checks every cell a 2x2 player covers, not only its position.
+func TestMoveBounds(t *testing.T) {
+	w, err := NewWorld(10, 10, Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AddObstacle(5, 5)
+	p := Player{Name: "Madalina", Item: Item{1, 1}}
+	id, err := w.Add(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		x, y int
+		err  error
+	}{
+		{4, 4, ErrBlocked}, // the obstacle is under the bottom-right cell
+		{4, 5, ErrBlocked},
+		{9, 0, ErrOutOfBounds}, // the right half is outside
+		{0, 9, ErrOutOfBounds},
+		{8, 8, nil},
+		{6, 5, nil},
+	}
+	for _, tc := range tests {
+		err := w.Move(id, tc.x, tc.y)
+		if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+			t.Errorf("Move to %d/%d: %v, want %v", tc.x, tc.y, err, tc.err)
+		}
+	}
+
+	if _, err := w.Add(&Player{Name: "Karim", Item: Item{9, 9}}); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("Add on the edge: %v, want %v", err, ErrOutOfBounds)
+	}
+
+	w.Policy = Clamp
+	if err := w.Move(id, 20, 20); err != nil || p.X != 8 || p.Y != 8 {
+		t.Errorf("clamped to %d/%d (%v), want 8/8", p.X, p.Y, err)
+	}
+	w.Policy = Wrap
+	if err := w.Move(id, -1, 9); err != nil || p.X != 8 || p.Y != 0 {
+		t.Errorf("wrapped to %d/%d (%v), want 8/0", p.X, p.Y, err)
+	}
+}
+
+func TestGridQueryDedupe(t *testing.T) {
+	g := NewGrid(4)
+	g.Insert(1, Rect{0, 0, 10, 10}) // spans 9 cells
+	g.Insert(2, Rect{3, 3, 2, 2})
+	ids := g.Query(Rect{0, 0, 10, 10})
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("Query = %v, want [1 2]", ids)
+	}
+}
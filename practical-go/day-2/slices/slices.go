@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"sort"
+
+	"day2/sliceutil"
 )
 
 func main() {
@@ -45,11 +47,22 @@ func main() {
 	// Will print both slices merged
 	fmt.Println(concat([]string{"A", "B"}, []string{"C", "D", "E"}))
 
+	// The same aliasing bug bites a naive concat: s4 has spare capacity, so append writes 999 straight into s2's
+	// underlying array instead of allocating a new one.
+	s4 := s2[:2]
+	s5 := append(s4, 999)
+	fmt.Printf("s5 = %#v, s2 (after naive concat) = %#v\n", s5, s2)
+
+	// sliceutil.Concat always allocates a new backing array, so the inputs are never touched.
+	s6 := sliceutil.Concat(s2[:2], []int{-1})
+	fmt.Printf("s6 = %#v, s2 (after sliceutil.Concat) = %#v\n", s6, s2)
+
 }
 
 func concat(s1, s2 []string) []string {
-	// s2... means that we are destructuring the slice
-	return append(s1, s2...)
+	// append(s1, s2...) would write into s1's underlying array whenever s1 has spare capacity (see s2/s3 above).
+	// Concat allocates a fresh slice instead, so neither input is ever modified.
+	return sliceutil.Concat(s1, s2)
 }
 
 func median(values []float64) (float64, error) {
@@ -63,7 +76,7 @@ func median(values []float64) (float64, error) {
 	// Is important to copy so that you don't create any unwanted side-effects.
 
 	nums := make([]float64, len(values))
-	copy(values, nums)
+	copy(nums, values) // copy(dst, src)
 
 	sort.Float64s(nums)
 	i := len(nums) / 2
@@ -0,0 +1,255 @@
+// Package sliceutil holds generic helpers for working with slices.
+//
+// Remember that a slice is only a view (pointer, len, cap) over an underlying array, so any function that appends to
+// or writes into its input can end up changing memory the caller still holds. Each function below says whether it
+// allocates a new backing array or reuses the one it was given. Every function that reuses its input has a *Copy
+// variant that never aliases the caller's memory.
+package sliceutil
+
+import "unsafe"
+
+// Clone returns a copy of s with its own backing array. Allocates.
+// A nil s stays nil, so the "nil safe" checks keep working on the result.
+func Clone[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+// Concat returns all the slices joined in order. Allocates, never aliases any of its inputs.
+//
+// This is the fix for the naive append(s1, s2...), which writes into s1's backing array whenever s1 has spare
+// capacity, silently changing any other slice that shares that array.
+func Concat[T any](ss ...[]T) []T {
+	size := 0
+	for _, s := range ss {
+		size += len(s)
+	}
+
+	out := make([]T, 0, size)
+	for _, s := range ss {
+		out = append(out, s...)
+	}
+	return out
+}
+
+// Chunk splits s into consecutive chunks of n elements, the last one may be shorter.
+// Reuses s: each chunk is a view into s. Their capacity is clipped to their length, so appending to a chunk
+// reallocates instead of overwriting the next chunk, but writing to a chunk element still writes into s.
+// Panics if n < 1.
+func Chunk[T any](s []T, n int) [][]T {
+	if n < 1 {
+		panic("sliceutil: chunk size must be positive")
+	}
+
+	chunks := make([][]T, 0, (len(s)+n-1)/n)
+	for i := 0; i < len(s); i += n {
+		end := i + n
+		if end > len(s) {
+			end = len(s)
+		}
+		chunks = append(chunks, s[i:end:end]) // full slice expression: s[low:high:max] caps the view
+	}
+	return chunks
+}
+
+// ChunkCopy is like Chunk but every chunk has its own backing array. Allocates.
+func ChunkCopy[T any](s []T, n int) [][]T {
+	chunks := Chunk(s, n)
+	for i := range chunks {
+		chunks[i] = Clone(chunks[i])
+	}
+	return chunks
+}
+
+// Window returns every run of n consecutive elements of s (a sliding window moving one element at a time).
+// Returns nil if s is shorter than n.
+// Reuses s: windows overlap and are views into s, with capacity clipped to n. Panics if n < 1.
+func Window[T any](s []T, n int) [][]T {
+	if n < 1 {
+		panic("sliceutil: window size must be positive")
+	}
+	if len(s) < n {
+		return nil
+	}
+
+	windows := make([][]T, 0, len(s)-n+1)
+	for i := 0; i+n <= len(s); i++ {
+		windows = append(windows, s[i:i+n:i+n])
+	}
+	return windows
+}
+
+// WindowCopy is like Window but every window has its own backing array. Allocates.
+func WindowCopy[T any](s []T, n int) [][]T {
+	windows := Window(s, n)
+	for i := range windows {
+		windows[i] = Clone(windows[i])
+	}
+	return windows
+}
+
+// Partition splits s into the elements that satisfy keep and those that don't, preserving order.
+// Allocates two new slices, s is left untouched.
+func Partition[T any](s []T, keep func(T) bool) (in, out []T) {
+	for _, v := range s {
+		if keep(v) {
+			in = append(in, v)
+		} else {
+			out = append(out, v)
+		}
+	}
+	return in, out
+}
+
+// Dedupe removes repeated elements from s, keeping the first occurrence of each value in its original order.
+// Reuses s: the result shares its backing array and the elements of s past the new length are zeroed, so the
+// garbage collector can reclaim whatever they pointed to. Use DedupeCopy if s is still needed afterwards.
+func Dedupe[T comparable](s []T) []T {
+	seen := make(map[T]struct{}, len(s))
+	return Filter(s, func(v T) bool {
+		if _, ok := seen[v]; ok {
+			return false
+		}
+		seen[v] = struct{}{}
+		return true
+	})
+}
+
+// DedupeCopy is like Dedupe but returns a new slice and leaves s untouched. Allocates.
+func DedupeCopy[T comparable](s []T) []T {
+	return Dedupe(Clone(s))
+}
+
+// Filter keeps the elements of s that satisfy keep, preserving order.
+// Reuses s: kept elements are moved to the front of s and the rest of s is zeroed. Use FilterCopy if s is still
+// needed afterwards.
+func Filter[T any](s []T, keep func(T) bool) []T {
+	n := 0
+	for _, v := range s {
+		if keep(v) {
+			s[n] = v
+			n++
+		}
+	}
+	zero(s[n:])
+	return s[:n]
+}
+
+// FilterCopy is like Filter but returns a new slice and leaves s untouched. Allocates.
+func FilterCopy[T any](s []T, keep func(T) bool) []T {
+	var out []T
+	for _, v := range s {
+		if keep(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Map returns a new slice with fn applied to every element of s. Allocates.
+func Map[T, U any](s []T, fn func(T) U) []U {
+	out := make([]U, len(s))
+	for i, v := range s {
+		out[i] = fn(v)
+	}
+	return out
+}
+
+// Reduce folds s into a single value, starting from init. Doesn't allocate and doesn't modify s.
+func Reduce[T, A any](s []T, init A, fn func(A, T) A) A {
+	acc := init
+	for _, v := range s {
+		acc = fn(acc, v)
+	}
+	return acc
+}
+
+// Insert inserts vs into s at index i, shifting the following elements up. Panics if i is out of range.
+// Reuses s when it has enough spare capacity - exactly like append, other slices sharing that backing array will see
+// the shifted elements. Otherwise it allocates. Use InsertCopy to never touch s.
+// vs can be a part of s, e.g. Insert(s, 0, s[1:]...): it's then copied first, so the shift doesn't move it from under
+// the copy.
+func Insert[T any](s []T, i int, vs ...T) []T {
+	_ = s[i:] // bounds check
+
+	n := len(s) + len(vs)
+	if n > cap(s) {
+		return InsertCopy(s, i, vs...)
+	}
+
+	s = s[:n]
+	if overlaps(s, vs) {
+		vs = Clone(vs)
+	}
+	copy(s[i+len(vs):], s[i:])
+	copy(s[i:], vs)
+	return s
+}
+
+// InsertCopy is like Insert but always returns a new slice and leaves s untouched. Allocates.
+func InsertCopy[T any](s []T, i int, vs ...T) []T {
+	_ = s[i:] // bounds check
+
+	out := make([]T, 0, len(s)+len(vs))
+	out = append(out, s[:i]...)
+	out = append(out, vs...)
+	return append(out, s[i:]...)
+}
+
+// Delete removes s[i:j], shifting the following elements down. Panics if s[i:j] is not a valid slice of s.
+// Reuses s: the result shares its backing array and the now unused tail of s is zeroed.
+// Use DeleteCopy if s is still needed afterwards.
+func Delete[T any](s []T, i, j int) []T {
+	_ = s[i:j] // bounds check
+
+	n := copy(s[i:], s[j:])
+	zero(s[i+n:])
+	return s[:i+n]
+}
+
+// DeleteCopy is like Delete but returns a new slice and leaves s untouched. Allocates.
+func DeleteCopy[T any](s []T, i, j int) []T {
+	_ = s[i:j] // bounds check
+
+	out := make([]T, 0, len(s)-(j-i))
+	out = append(out, s[:i]...)
+	return append(out, s[j:]...)
+}
+
+// Reverse reverses s in place. Reuses s, doesn't allocate.
+func Reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// ReverseCopy returns a reversed copy of s and leaves s untouched. Allocates.
+func ReverseCopy[T any](s []T) []T {
+	out := Clone(s)
+	Reverse(out)
+	return out
+}
+
+// overlaps reports whether a and b share any element of the same backing array. Go has no safe way to compare the
+// addresses of two slices, this is what the standard library's slices package does too.
+func overlaps[T any](a, b []T) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	size := unsafe.Sizeof(a[0])
+	if size == 0 {
+		return false // zero-size elements don't hold anything to overwrite
+	}
+	return uintptr(unsafe.Pointer(&a[0])) <= uintptr(unsafe.Pointer(&b[len(b)-1]))+(size-1) &&
+		uintptr(unsafe.Pointer(&b[0])) <= uintptr(unsafe.Pointer(&a[len(a)-1]))+(size-1)
+}
+
+// zero sets every element of s to its zero value, dropping any references it held.
+func zero[T any](s []T) {
+	var z T
+	for i := range s {
+		s[i] = z
+	}
+}
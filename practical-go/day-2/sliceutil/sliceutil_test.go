@@ -0,0 +1,322 @@
+package sliceutil
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// sameArray reports whether a and b start at the same element of the same backing array.
+func sameArray[T any](a, b []T) bool {
+	return cap(a) > 0 && cap(b) > 0 && &a[:1][0] == &b[:1][0]
+}
+
+func isEven(v int) bool { return v%2 == 0 }
+
+func TestClone(t *testing.T) {
+	if got := Clone[int](nil); got != nil {
+		t.Errorf("Clone(nil) = %#v, want nil", got)
+	}
+	if got := Clone([]int{}); got == nil || len(got) != 0 {
+		t.Errorf("Clone([]int{}) = %#v, want an empty non-nil slice", got)
+	}
+
+	s := []int{1, 2, 3}
+	c := Clone(s)
+	if !reflect.DeepEqual(c, s) {
+		t.Fatalf("Clone = %v, want %v", c, s)
+	}
+	if sameArray(c, s) {
+		t.Error("Clone shares the backing array of its input")
+	}
+}
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		ss   [][]int
+		want []int
+	}{
+		{nil, []int{}},
+		{[][]int{{1}, nil, {2, 3}}, []int{1, 2, 3}},
+		{[][]int{{}, {}}, []int{}},
+	}
+	for _, tc := range tests {
+		if got := Concat(tc.ss...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Concat(%v) = %v, want %v", tc.ss, got, tc.want)
+		}
+	}
+
+	// The bug Concat is for: s1 has spare capacity, append would write into it.
+	backing := []int{1, 2, 3, 4}
+	s1, other := backing[:2], backing[:3]
+	got := Concat(s1, []int{9})
+	if !reflect.DeepEqual(got, []int{1, 2, 9}) || other[2] != 3 {
+		t.Errorf("Concat = %v and other = %v, want [1 2 9] and other unchanged", got, other)
+	}
+	if sameArray(got, s1) {
+		t.Error("Concat shares the backing array of its first input")
+	}
+}
+
+func TestChunk(t *testing.T) {
+	tests := []struct {
+		s    []int
+		n    int
+		want [][]int
+	}{
+		{nil, 2, [][]int{}},
+		{[]int{1, 2, 3, 4}, 2, [][]int{{1, 2}, {3, 4}}},
+		{[]int{1, 2, 3, 4, 5}, 2, [][]int{{1, 2}, {3, 4}, {5}}},
+		{[]int{1, 2}, 5, [][]int{{1, 2}}},
+	}
+	for _, tc := range tests {
+		for name, chunk := range map[string]func([]int, int) [][]int{"Chunk": Chunk[int], "ChunkCopy": ChunkCopy[int]} {
+			if got := chunk(tc.s, tc.n); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s(%v, %d) = %v, want %v", name, tc.s, tc.n, got, tc.want)
+			}
+		}
+	}
+
+	s := []int{1, 2, 3, 4}
+	chunks := Chunk(s, 2)
+	if !sameArray(chunks[1], s[2:]) {
+		t.Error("Chunk copied its input, it should reuse it")
+	}
+	_ = append(chunks[0], 99) // capacity clipped, must not overwrite chunks[1]
+	if s[2] != 3 {
+		t.Errorf("appending to a chunk overwrote the next one: %v", s)
+	}
+
+	copies := ChunkCopy(s, 2)
+	copies[0][0] = 99
+	if s[0] != 1 {
+		t.Errorf("writing to a ChunkCopy chunk changed the input: %v", s)
+	}
+
+	mustPanic(t, "Chunk(s, 0)", func() { Chunk(s, 0) })
+}
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		s    []int
+		n    int
+		want [][]int
+	}{
+		{[]int{1, 2}, 3, nil},
+		{[]int{1, 2, 3}, 3, [][]int{{1, 2, 3}}},
+		{[]int{1, 2, 3, 4}, 2, [][]int{{1, 2}, {2, 3}, {3, 4}}},
+	}
+	for _, tc := range tests {
+		for name, window := range map[string]func([]int, int) [][]int{"Window": Window[int], "WindowCopy": WindowCopy[int]} {
+			if got := window(tc.s, tc.n); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s(%v, %d) = %v, want %v", name, tc.s, tc.n, got, tc.want)
+			}
+		}
+	}
+
+	s := []int{1, 2, 3}
+	windows := Window(s, 2)
+	if !sameArray(windows[1], s[1:]) || cap(windows[0]) != 2 {
+		t.Error("Window must return views into its input, with capacity clipped to n")
+	}
+	WindowCopy(s, 2)[0][1] = 99
+	if s[1] != 2 {
+		t.Errorf("writing to a WindowCopy window changed the input: %v", s)
+	}
+
+	mustPanic(t, "Window(s, 0)", func() { Window(s, 0) })
+}
+
+func TestPartition(t *testing.T) {
+	s := []int{1, 2, 3, 4, 5}
+	in, out := Partition(s, isEven)
+	if !reflect.DeepEqual(in, []int{2, 4}) || !reflect.DeepEqual(out, []int{1, 3, 5}) {
+		t.Errorf("Partition = %v, %v, want [2 4], [1 3 5]", in, out)
+	}
+	if !reflect.DeepEqual(s, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("Partition changed its input: %v", s)
+	}
+}
+
+func TestFilterAndDedupe(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func([]int) []int
+		copy bool // never touches its input
+		s    []int
+		want []int
+	}{
+		{"Filter", func(s []int) []int { return Filter(s, isEven) }, false, []int{1, 2, 3, 4}, []int{2, 4}},
+		{"FilterCopy", func(s []int) []int { return FilterCopy(s, isEven) }, true, []int{1, 2, 3, 4}, []int{2, 4}},
+		{"Dedupe", Dedupe[int], false, []int{3, 1, 3, 2, 1}, []int{3, 1, 2}},
+		{"DedupeCopy", DedupeCopy[int], true, []int{3, 1, 3, 2, 1}, []int{3, 1, 2}},
+		{"Dedupe empty", Dedupe[int], false, []int{}, []int{}},
+	}
+
+	for _, tc := range tests {
+		s := Clone(tc.s)
+		got := tc.fn(s)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s(%v) = %v, want %v", tc.name, tc.s, got, tc.want)
+		}
+
+		if tc.copy {
+			if !reflect.DeepEqual(s, tc.s) {
+				t.Errorf("%s changed its input to %v", tc.name, s)
+			}
+			continue
+		}
+		if len(got) > 0 && !sameArray(got, s) {
+			t.Errorf("%s doesn't reuse its input", tc.name)
+		}
+		for i, v := range s[len(got):] {
+			if v != 0 {
+				t.Errorf("%s left %d at %d past the new length, want it zeroed", tc.name, v, len(got)+i)
+			}
+		}
+	}
+}
+
+func TestMapReduce(t *testing.T) {
+	s := []int{1, 2, 3}
+	if got := Map(s, strconv.Itoa); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("Map = %v", got)
+	}
+	if got := Map[int, int](nil, func(v int) int { return v }); len(got) != 0 {
+		t.Errorf("Map(nil) = %v", got)
+	}
+
+	sum := func(acc, v int) int { return acc + v }
+	if got := Reduce(s, 10, sum); got != 16 {
+		t.Errorf("Reduce = %d, want 16", got)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { Reduce(s, 0, sum) }); allocs != 0 {
+		t.Errorf("Reduce allocates %v times, want 0", allocs)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	tests := []struct {
+		s    []int
+		i    int
+		vs   []int
+		want []int
+	}{
+		{nil, 0, []int{1}, []int{1}},
+		{[]int{1, 4}, 1, []int{2, 3}, []int{1, 2, 3, 4}},
+		{[]int{1, 2}, 2, []int{3}, []int{1, 2, 3}},
+		{[]int{2, 3}, 0, []int{1}, []int{1, 2, 3}},
+		{[]int{1, 2}, 1, nil, []int{1, 2}},
+	}
+	for _, tc := range tests {
+		if got := InsertCopy(tc.s, tc.i, tc.vs...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("InsertCopy(%v, %d, %v) = %v, want %v", tc.s, tc.i, tc.vs, got, tc.want)
+		}
+		// With and without spare capacity, Insert takes a different path.
+		for _, spare := range []int{0, 10} {
+			s := append(make([]int, 0, len(tc.s)+spare), tc.s...)
+			if got := Insert(s, tc.i, tc.vs...); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Insert(%v, %d, %v) with %d spare = %v, want %v", tc.s, tc.i, tc.vs, spare, got, tc.want)
+			}
+		}
+	}
+
+	// Spare capacity: Insert works in place, InsertCopy doesn't.
+	s := make([]int, 2, 10)
+	s[0], s[1] = 1, 3
+	if got := Insert(s, 1, 2); !sameArray(got, s) {
+		t.Error("Insert with spare capacity allocated")
+	}
+	s[0], s[1] = 1, 3
+	if got := InsertCopy(s, 1, 2); sameArray(got, s) || s[1] != 3 {
+		t.Error("InsertCopy touched its input")
+	}
+
+	mustPanic(t, "Insert out of range", func() { Insert([]int{1}, 2, 0) })
+}
+
+func TestInsertAliasing(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(s []int) []int
+		want []int
+	}{
+		{"tail at the front", func(s []int) []int { return Insert(s, 0, s[1:]...) }, []int{2, 3, 4, 1, 2, 3, 4}},
+		{"head at the end", func(s []int) []int { return Insert(s, 4, s[:2]...) }, []int{1, 2, 3, 4, 1, 2}},
+		{"itself in the middle", func(s []int) []int { return Insert(s, 2, s...) }, []int{1, 2, 1, 2, 3, 4, 3, 4}},
+		{"spare capacity", func(s []int) []int { return Insert(s, 0, s[4:6]...) }, []int{5, 6, 1, 2, 3, 4}},
+	}
+
+	for _, tc := range tests {
+		backing := make([]int, 4, 16)
+		copy(backing, []int{1, 2, 3, 4})
+		copy(backing[4:6], []int{5, 6})
+		if got := tc.fn(backing); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		s    []int
+		i, j int
+		want []int
+	}{
+		{[]int{1, 2, 3, 4}, 1, 3, []int{1, 4}},
+		{[]int{1, 2, 3}, 0, 3, []int{}},
+		{[]int{1, 2, 3}, 1, 1, []int{1, 2, 3}},
+		{[]int{1, 2, 3}, 2, 3, []int{1, 2}},
+	}
+	for _, tc := range tests {
+		in := Clone(tc.s)
+		if got := DeleteCopy(in, tc.i, tc.j); !reflect.DeepEqual(got, tc.want) || !reflect.DeepEqual(in, tc.s) {
+			t.Errorf("DeleteCopy(%v, %d, %d) = %v and input %v, want %v and input unchanged", tc.s, tc.i, tc.j, got, in, tc.want)
+		}
+
+		got := Delete(in, tc.i, tc.j)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Delete(%v, %d, %d) = %v, want %v", tc.s, tc.i, tc.j, got, tc.want)
+		}
+		for k, v := range in[len(got):] {
+			if v != 0 {
+				t.Errorf("Delete left %d at %d past the new length, want it zeroed", v, len(got)+k)
+			}
+		}
+	}
+
+	mustPanic(t, "Delete out of range", func() { Delete([]int{1}, 0, 2) })
+}
+
+func TestReverse(t *testing.T) {
+	for _, tc := range []struct{ s, want []int }{
+		{nil, nil},
+		{[]int{1}, []int{1}},
+		{[]int{1, 2, 3, 4}, []int{4, 3, 2, 1}},
+		{[]int{1, 2, 3}, []int{3, 2, 1}},
+	} {
+		in := Clone(tc.s)
+		if got := ReverseCopy(in); !reflect.DeepEqual(got, tc.want) || !reflect.DeepEqual(in, tc.s) {
+			t.Errorf("ReverseCopy(%v) = %v, changed the input to %v", tc.s, got, in)
+		}
+		Reverse(in)
+		if !reflect.DeepEqual(in, tc.want) {
+			t.Errorf("Reverse(%v) = %v, want %v", tc.s, in, tc.want)
+		}
+	}
+
+	s := []int{1, 2, 3}
+	if allocs := testing.AllocsPerRun(100, func() { Reverse(s) }); allocs != 0 {
+		t.Errorf("Reverse allocates %v times, want 0", allocs)
+	}
+}
+
+func mustPanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s didn't panic", name)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,414 @@
+// Stats reads numbers and prints a summary of them plus a histogram.
+//
+// Usage:
+//
+//	stats [flags] [file]
+//
+// Numbers are read from file, or from stdin when no file is given. By default any whitespace or comma separated
+// numbers are accepted, e.g. `seq 100 | stats`. With -col the input is parsed as CSV and only that column is used, it
+// can be a 1-based index or a header name (the first row is then treated as the header).
+//
+// With -json the summary is printed as JSON instead, so benchmark results can be piped straight into other tools.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	col := flag.String("col", "", "CSV column to read, 1-based index or header name")
+	bins := flag.Int("bins", 10, "number of histogram bins")
+	width := flag.Int("width", 40, "width of the longest histogram bar")
+	pcts := flag.String("p", "50,90,95,99", "comma separated percentiles to report")
+	asJSON := flag.Bool("json", false, "print the summary as JSON")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("stats: ")
+
+	if *bins < 1 {
+		log.Fatalf("error: -bins must be positive, got %d", *bins)
+	}
+	if *width < 1 {
+		log.Fatalf("error: -width must be positive, got %d", *width)
+	}
+
+	ps, err := parsePercentiles(*pcts)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("error: %s", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var values []float64
+	if *col != "" {
+		values, err = readColumn(r, *col)
+	} else {
+		values, err = readNumbers(r)
+	}
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+
+	s, err := summarize(values, ps, *bins)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s); err != nil {
+			log.Fatalf("error: can't encode - %s", err)
+		}
+		return
+	}
+
+	printSummary(os.Stdout, s)
+	fmt.Println()
+	printHistogram(os.Stdout, s.Histogram, *width)
+}
+
+// Summary holds the statistics of a set of numbers.
+type Summary struct {
+	Count       int                `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Mean        float64            `json:"mean"`
+	Median      float64            `json:"median"`
+	StdDev      float64            `json:"stddev"`
+	Percentiles map[string]float64 `json:"percentiles"`
+	Histogram   []Bin              `json:"histogram"`
+}
+
+// Bin is a single histogram bucket, holding the values in [Low, High).
+// The last bin also holds the values equal to High.
+type Bin struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int     `json:"count"`
+}
+
+func summarize(values []float64, ps []float64, bins int) (Summary, error) {
+	if len(values) == 0 {
+		return Summary{}, fmt.Errorf("no numbers to summarize")
+	}
+
+	// Copy before sorting, so we don't sort the caller's underlying array.
+	nums := make([]float64, len(values))
+	copy(nums, values)
+	sort.Float64s(nums)
+
+	med, err := median(nums)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	s := Summary{
+		Count:       len(nums),
+		Min:         nums[0],
+		Max:         nums[len(nums)-1],
+		Mean:        mean(nums),
+		Median:      med,
+		StdDev:      stdDev(nums),
+		Percentiles: make(map[string]float64, len(ps)),
+		Histogram:   histogram(nums, bins),
+	}
+	if math.IsInf(s.StdDev, 0) {
+		return Summary{}, fmt.Errorf("the standard deviation is too large for a float64, the numbers are too far apart")
+	}
+	for _, p := range ps {
+		s.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(nums, p)
+	}
+
+	return s, nil
+}
+
+func median(values []float64) (float64, error) {
+
+	if len(values) == 0 {
+		return 0, fmt.Errorf("median of empty slice")
+	}
+
+	// Same as median in slices.go, copy so that sorting doesn't create any unwanted side-effects.
+	// Note the order of the arguments, copy(dst, src).
+	nums := make([]float64, len(values))
+	copy(nums, values)
+
+	sort.Float64s(nums)
+	i := len(nums) / 2
+
+	if len(nums)%2 == 1 {
+		return nums[i], nil
+	}
+
+	v := (nums[i-1] + nums[i]) / 2
+	return v, nil
+}
+
+// mean divides before adding, the sum of finite values near math.MaxFloat64 would overflow to infinity.
+func mean(values []float64) float64 {
+	var m float64
+	n := float64(len(values))
+	for _, v := range values {
+		m += v / n
+	}
+	return m
+}
+
+// stdDev returns the sample standard deviation (divides by n-1), which is what you want when the numbers are a
+// sample of runs, like benchmark results. A single value has no deviation.
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	// Work on the values scaled down to [-1, 1], the squares of large values would overflow. The result can still be
+	// infinite, when the deviation itself is larger than math.MaxFloat64.
+	var scale float64
+	for _, v := range values {
+		scale = math.Max(scale, math.Abs(v))
+	}
+	if scale == 0 {
+		return 0
+	}
+
+	m := mean(values) / scale
+	var sum float64
+	for _, v := range values {
+		d := v/scale - m
+		sum += d * d
+	}
+	return math.Sqrt(sum/float64(len(values)-1)) * scale
+}
+
+// percentile returns the p-th percentile (0-100) of sorted, interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+
+	// Not sorted[lo] + (sorted[hi]-sorted[lo])*frac: the difference of two finite values can overflow.
+	return sorted[lo]*(1-frac) + sorted[hi]*frac
+}
+
+// histogram splits the range of sorted into n equally sized bins.
+//
+// hi - lo overflows to infinity when the values span more than math.MaxFloat64, e.g. -1e308 and 1e308, so the
+// computations work on half the range instead, which always fits.
+func histogram(sorted []float64, n int) []Bin {
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	if lo == hi {
+		// Every value is the same, a single bin is all we can draw.
+		return []Bin{{Low: lo, High: hi, Count: len(sorted)}}
+	}
+
+	half := hi/2 - lo/2
+	edge := func(i int) float64 {
+		f := float64(i) / float64(n)
+		return lo + half*f + half*f
+	}
+	bins := make([]Bin, n)
+	for i := range bins {
+		bins[i].Low = edge(i)
+		bins[i].High = edge(i + 1)
+	}
+	bins[n-1].High = hi // avoid floating point drift on the last edge
+
+	for _, v := range sorted {
+		i := int((v/2 - lo/2) / half * float64(n))
+		if i < 0 {
+			i = 0 // rounding below lo
+		}
+		if i >= n {
+			i = n - 1 // v == hi belongs to the last bin
+		}
+		bins[i].Count++
+	}
+
+	return bins
+}
+
+func printSummary(w io.Writer, s Summary) {
+	fmt.Fprintf(w, "count   %d\n", s.Count)
+	fmt.Fprintf(w, "min     %g\n", s.Min)
+	fmt.Fprintf(w, "max     %g\n", s.Max)
+	fmt.Fprintf(w, "mean    %g\n", s.Mean)
+	fmt.Fprintf(w, "median  %g\n", s.Median)
+	fmt.Fprintf(w, "stddev  %g\n", s.StdDev)
+
+	// Maps have no order, sort the keys by their numeric value so p9 comes before p50.
+	keys := make([]string, 0, len(s.Percentiles))
+	for k := range s.Percentiles {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, _ := strconv.ParseFloat(keys[i][1:], 64)
+		pj, _ := strconv.ParseFloat(keys[j][1:], 64)
+		return pi < pj
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%-7s %g\n", k, s.Percentiles[k])
+	}
+}
+
+// blocks are the Unicode eighth blocks, they let a bar end on 1/8 of a character.
+var blocks = []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉', '█'}
+
+func printHistogram(w io.Writer, bins []Bin, width int) {
+	maxCount := 0
+	for _, b := range bins {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+
+	for _, b := range bins {
+		fmt.Fprintf(w, "[%10.4g, %10.4g] %s %d\n", b.Low, b.High, bar(b.Count, maxCount, width), b.Count)
+	}
+}
+
+// bar draws count as a bar scaled so that max fills width characters.
+func bar(count, max, width int) string {
+	if max == 0 {
+		return strings.Repeat(" ", width)
+	}
+
+	eighths := count * width * 8 / max
+	full, rest := eighths/8, eighths%8
+
+	var sb strings.Builder
+	sb.WriteString(strings.Repeat(string(blocks[8]), full))
+	if rest > 0 {
+		sb.WriteRune(blocks[rest])
+		full++
+	}
+	sb.WriteString(strings.Repeat(" ", width-full))
+	return sb.String()
+}
+
+// readNumbers reads any whitespace or comma separated numbers from r.
+func readNumbers(r io.Reader) ([]float64, error) {
+	var values []float64
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		for _, field := range strings.Split(scanner.Text(), ",") {
+			if field == "" {
+				continue
+			}
+			v, err := parseNumber(field)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// readColumn reads the numbers in column col of the CSV in r. col is either a 1-based index or a header name, in
+// which case the first row is the header.
+func readColumn(r io.Reader, col string) ([]float64, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // allow ragged rows, we only care about one column
+	cr.TrimLeadingSpace = true
+
+	idx, err := strconv.Atoi(col)
+	if err != nil {
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("can't read CSV header - %w", err)
+		}
+		idx = 0
+		for i, name := range header {
+			if strings.TrimSpace(name) == col {
+				idx = i + 1
+				break
+			}
+		}
+		if idx == 0 {
+			return nil, fmt.Errorf("column %q not found in header %v", col, header)
+		}
+	}
+	if idx < 1 {
+		return nil, fmt.Errorf("column index must be 1 or more, got %d", idx)
+	}
+
+	var values []float64
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < idx || strings.TrimSpace(record[idx-1]) == "" {
+			continue // missing value
+		}
+
+		field := strings.TrimSpace(record[idx-1])
+		v, err := parseNumber(field)
+		if err != nil {
+			line, _ := cr.FieldPos(idx - 1)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// parseNumber parses a finite number. ParseFloat also accepts "inf" and "NaN", which have no place in a histogram.
+func parseNumber(field string) (float64, error) {
+	v, err := strconv.ParseFloat(field, 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("bad number %q", field)
+	}
+	return v, nil
+}
+
+func parsePercentiles(s string) ([]float64, error) {
+	var ps []float64
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil || math.IsNaN(p) || p < 0 || p > 100 {
+			return nil, fmt.Errorf("bad percentile %q, must be between 0 and 100", field)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
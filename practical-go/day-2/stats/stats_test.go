@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{7}, 50, 7},
+		{[]float64{1, 2, 3, 4}, 0, 1},
+		{[]float64{1, 2, 3, 4}, 100, 4},
+		{[]float64{1, 2, 3, 4}, 50, 2.5},
+		{[]float64{1, 2, 3, 4, 5}, 90, 4.6},
+		{[]float64{-1e308, 1e308}, 50, 0}, // the difference overflows
+		{[]float64{-1e308, 1e308}, 100, 1e308},
+	}
+
+	for _, tc := range tests {
+		got := percentile(tc.sorted, tc.p)
+		if math.Abs(got-tc.want) > 1e-9*math.Max(1, math.Abs(tc.want)) {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tc.sorted, tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	for _, s := range []string{"NaN", "nan", "-1", "101", "50,x", "inf"} {
+		if ps, err := parsePercentiles(s); err == nil {
+			t.Errorf("parsePercentiles(%q) = %v, want an error", s, ps)
+		}
+	}
+
+	ps, err := parsePercentiles("50, 99.9,,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 || ps[0] != 50 || ps[1] != 99.9 || ps[2] != 0 {
+		t.Errorf("parsePercentiles = %v, want [50 99.9 0]", ps)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []float64
+		n      int
+		counts []int
+	}{
+		{"single value", []float64{3, 3, 3}, 5, []int{3}},
+		{"one bin", []float64{1, 2, 3}, 1, []int{3}},
+		{"hi in the last bin", []float64{0, 1, 2, 3, 4}, 4, []int{1, 1, 1, 2}},
+		{"negative", []float64{-10, -5, 0}, 2, []int{1, 2}},
+		{"range overflows", []float64{-1.7e308, 0, 1.7e308}, 2, []int{1, 2}},
+		{"range overflows, one bin", []float64{-1.7e308, 1.7e308}, 1, []int{2}},
+		{"max floats", []float64{-math.MaxFloat64, math.MaxFloat64}, 3, []int{1, 0, 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bins := histogram(tc.sorted, tc.n)
+			if len(bins) != len(tc.counts) {
+				t.Fatalf("%d bins, want %d", len(bins), len(tc.counts))
+			}
+
+			total := 0
+			for i, b := range bins {
+				if b.Count != tc.counts[i] {
+					t.Errorf("bin %d %v has %d values, want %d", i, b, b.Count, tc.counts[i])
+				}
+				if math.IsInf(b.Low, 0) || math.IsInf(b.High, 0) || b.Low > b.High {
+					t.Errorf("bin %d has bad edges %v", i, b)
+				}
+				total += b.Count
+			}
+			if total != len(tc.sorted) {
+				t.Errorf("%d values in the bins, want %d", total, len(tc.sorted))
+			}
+			if bins[0].Low != tc.sorted[0] || bins[len(bins)-1].High != tc.sorted[len(tc.sorted)-1] {
+				t.Errorf("bins cover [%v, %v], want [%v, %v]",
+					bins[0].Low, bins[len(bins)-1].High, tc.sorted[0], tc.sorted[len(tc.sorted)-1])
+			}
+		})
+	}
+}
+
+func TestReadNumbers(t *testing.T) {
+	for _, in := range []string{"1 2 inf", "1 NaN 3", "1,-Inf", "1e400", "x"} {
+		if values, err := readNumbers(strings.NewReader(in)); err == nil {
+			t.Errorf("readNumbers(%q) = %v, want an error", in, values)
+		}
+	}
+
+	values, err := readNumbers(strings.NewReader("1,2 3\n4.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 4 || values[3] != 4.5 {
+		t.Errorf("readNumbers = %v, want [1 2 3 4.5]", values)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s, err := summarize([]float64{4, 1, 3, 2}, []float64{50}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count != 4 || s.Min != 1 || s.Max != 4 || s.Mean != 2.5 || s.Median != 2.5 || s.Percentiles["p50"] != 2.5 {
+		t.Errorf("summarize = %+v", s)
+	}
+
+	if _, err := summarize(nil, nil, 2); err == nil {
+		t.Error("summarize of no numbers didn't fail")
+	}
+	// The deviation of these is larger than math.MaxFloat64.
+	if _, err := summarize([]float64{-1.7e308, 1.7e308}, nil, 2); err == nil {
+		t.Error("summarize with an infinite deviation didn't fail")
+	}
+}